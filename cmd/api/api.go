@@ -12,8 +12,12 @@ import (
 
 	"github.com/looksaw/social/docs"
 	"github.com/looksaw/social/internal/auth"
+	"github.com/looksaw/social/internal/blob"
 	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/outbox"
+	"github.com/looksaw/social/internal/pubsub"
 	"github.com/looksaw/social/internal/store"
+	"github.com/looksaw/social/internal/webhook"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
@@ -24,17 +28,90 @@ type application struct {
 	logger        *zap.SugaredLogger //结构化的LOG
 	mailer        mailer.Client      //发送mail的客户端
 	authenticator auth.Authenticator //认证的类
+	blobs         blob.BlobStore     //媒体文件的存储
+	mediaQueue    chan int64         //等待处理的图片
+	hub           *pubsub.Hub        //进程内的事件订阅
+	events        pubsub.Publisher   //事件发布,经过数据库广播到所有实例
+	webhooks      *webhook.Client    //投递webhook的客户端
+	outbox        *outbox.Dispatcher //领域事件的分发
 }
 
 // config的配置
 type config struct {
-	addr        string     //服务的端口
-	db          dbConfig   //db的设置
-	env         string     //是什么环境
-	apiURL      string     //Swagger用的
-	mail        mailConfig // mail的配置
-	frontEndURL string     //前端的URL
-	auth        authConfig //认证设计
+	addr        string          //服务的端口
+	db          dbConfig        //db的设置
+	env         string          //是什么环境
+	apiURL      string          //Swagger用的
+	mail        mailConfig      // mail的配置
+	frontEndURL string          //前端的URL
+	auth        authConfig      //认证设计
+	deletion    deletionConfig  //账户删除的配置
+	export      exportConfig    //个人数据导出的配置
+	scheduler   schedulerConfig //定时发布的配置
+	trash       trashConfig     //回收站的配置
+	media       mediaConfig     //媒体文件的配置
+	webhook     webhookConfig   //webhook投递的配置
+	outbox      outboxConfig    //领域事件的配置
+}
+
+// 领域事件的配置
+type outboxConfig struct {
+	pollInterval time.Duration //检查未分发事件的间隔
+	retention    time.Duration //处理完的事件保留多久
+}
+
+// webhook投递的配置
+type webhookConfig struct {
+	pollInterval time.Duration //检查到期投递的间隔
+	timeout      time.Duration //单次投递的超时
+	batchSize    int           //每次领取的投递数量
+}
+
+// 媒体文件的配置
+type mediaConfig struct {
+	maxBytes  int64    //单个文件的最大字节数
+	maxPixels int      //图片的最大像素数,防止解压炸弹
+	workers   int      //处理图片的worker数量
+	backend   string   //local或者s3
+	dir       string   //local存储的目录
+	s3        s3Config //s3存储的配置
+	//上传后超过这个时间还没有挂到帖子上的文件会被删除
+	unattachedTTL time.Duration
+}
+
+// S3兼容存储的配置
+type s3Config struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+}
+
+// 回收站的配置
+type trashConfig struct {
+	retention time.Duration //删除的内容保留多久
+	interval  time.Duration //清理任务的执行间隔
+}
+
+// 定时发布的配置
+type schedulerConfig struct {
+	publishInterval time.Duration //检查到期定时帖子的间隔
+}
+
+// 个人数据导出的配置
+type exportConfig struct {
+	dir         string        //导出文件的存放目录
+	exp         time.Duration //下载链接的有效期
+	secret      string        //下载链接的签名密钥
+	downloadURL string        //下载链接的前缀
+}
+
+// 账户删除的配置
+type deletionConfig struct {
+	grace    time.Duration //宽限期,期间重新登陆可以取消删除
+	policy   string        //删除时对帖子和评论的处理策略
+	interval time.Duration //后台清理任务的执行间隔
 }
 
 type authConfig struct {
@@ -55,10 +132,16 @@ type basicConfig struct {
 
 // mail的相关配置
 type mailConfig struct {
-	fromEmail string
-	sendGrid  sendGridConfig
-	mailTrip  mailTripConfig
-	exp       time.Duration
+	fromEmail         string
+	sendGrid          sendGridConfig
+	mailTrip          mailTripConfig
+	exp               time.Duration
+	digestInterval    time.Duration //检查到期摘要邮件的间隔
+	unsubscribeSecret string        //退订链接的签名密钥
+	unsubscribeURL    string        //退订链接的前缀
+	workers           int           //发送队列的worker数量
+	pollInterval      time.Duration //检查发送队列的间隔
+	jobRetention      time.Duration //发送成功的任务保留多久
 }
 
 // Send Grid的相关配置
@@ -88,9 +171,9 @@ func (app *application) mount() http.Handler {
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders:   []string{"Link", "ETag", "Last-Modified"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -116,21 +199,68 @@ func (app *application) mount() http.Handler {
 				//使用制作中间件
 				r.Use(app.postContextMiddleware)
 				//GET方法
-				r.Get("/", app.getPostHandler)
+				r.With(app.cacheControl(cachePrivateRevalidate)).Get("/", app.getPostHandler)
 				//Delete方法
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
 				//PAtch方法
 				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				//评论
+				r.Post("/comments", app.createCommentHandler)
+				r.Delete("/comments/{commentID}", app.deleteCommentHandler)
+				//修订记录
+				r.Get("/revisions", app.getPostRevisionsHandler)
+				//恢复修订记录,只有moderator以上可以
+				r.With(app.requireRole("moderator")).Post("/revisions/{revisionID}/restore", app.restorePostRevisionHandler)
+				//投票
+				r.Post("/poll/votes", app.votePollHandler)
+				//置顶
+				r.Put("/pin", app.pinPostHandler)
+				r.Delete("/pin", app.unpinPostHandler)
+				//实时评论
+				r.Get("/live", app.livePostHandler)
 			})
 		})
+		//媒体文件
+		r.Route("/media", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Post("/", app.uploadMediaHandler)
+			r.Get("/{mediaID}", app.getMediaHandler)
+		})
 		//User的路由
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			//当前登陆的用户
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				//申请删除账户
+				r.Delete("/", app.deleteUserHandler)
+				//用户设置
+				r.Patch("/settings", app.updateSettingsHandler)
+				//邮件偏好
+				r.Get("/email-preferences", app.getEmailPreferencesHandler)
+				r.Put("/email-preferences", app.updateEmailPreferencesHandler)
+				//导出个人数据
+				r.Post("/export", app.requestExportHandler)
+				//推荐关注
+				r.Get("/suggestions", app.getSuggestionsHandler)
+				//提及我的记录
+				r.Get("/mentions", app.getUserMentionsHandler)
+				//草稿和定时发布的帖子
+				r.Get("/drafts", app.getDraftsHandler)
+				//回收站
+				r.Get("/trash", app.getTrashHandler)
+				r.Post("/trash/posts/{postID}/restore", app.restorePostHandler)
+				r.Post("/trash/comments/{commentID}/restore", app.restoreCommentHandler)
+			})
+			//下载导出的数据,通过签名验证
+			r.Get("/exports/{name}", app.downloadExportHandler)
 			r.Route("/{userID}", func(r chi.Router) {
 				//中间件
 				r.Use(app.AuthTokenMiddleware)
 				//得到用户信息
-				r.Get("/", app.getUserHandler)
+				r.With(app.cacheControl(cachePrivateRevalidate)).Get("/", app.getUserHandler)
+				//作者主页的帖子
+				r.With(app.cacheControl(cachePrivateRevalidate)).Get("/posts", app.getUserPostsHandler)
 				//关注某人
 				r.Put("/follow", app.followUserHandler)
 				//取消关注某人
@@ -139,9 +269,55 @@ func (app *application) mount() http.Handler {
 			//目前没有身份验证，姑且这样
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.With(app.cacheControl(cachePrivateRevalidate)).Get("/feed", app.getUserFeedHandler)
+			})
+		})
+		//标签自动补全
+		r.With(app.AuthTokenMiddleware, app.cacheControl(cachePrivateShort)).Get("/tags", app.searchTagsHandler)
+		//实时推送
+		r.With(app.AuthTokenMiddleware).Get("/stream", app.streamHandler)
+		//通知
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.getNotificationsHandler)
+			r.Post("/read", app.markNotificationsReadHandler)
+		})
+		//私信
+		r.Route("/conversations", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Post("/", app.createConversationHandler)
+			r.Get("/", app.getConversationsHandler)
+			r.Route("/{conversationID}", func(r chi.Router) {
+				r.Get("/", app.getConversationHandler)
+				r.Get("/messages", app.getMessagesHandler)
+				r.Post("/messages", app.sendMessageHandler)
+				//已读回执
+				r.Post("/read", app.markConversationReadHandler)
 			})
 		})
+		//webhook订阅,只有admin可以管理
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware, app.requireRole("admin"))
+			r.Post("/", app.createWebhookHandler)
+			r.Get("/", app.getWebhooksHandler)
+			r.Route("/{webhookID}", func(r chi.Router) {
+				r.Get("/", app.getWebhookHandler)
+				r.Patch("/", app.updateWebhookHandler)
+				r.Delete("/", app.deleteWebhookHandler)
+				//投递日志和重新投递
+				r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+				r.Post("/deliveries/{deliveryID}/redeliver", app.redeliverWebhookHandler)
+			})
+		})
+		//发送失败的邮件,只有admin可以查看和重试
+		r.Route("/email-jobs", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware, app.requireRole("admin"))
+			r.Get("/dead", app.getDeadEmailJobsHandler)
+			r.Post("/{jobID}/retry", app.retryEmailJobHandler)
+		})
+		//邮件中的退订链接,通过签名验证,GET只显示确认页面,POST才退订
+		r.Get("/email/unsubscribe", app.confirmUnsubscribeHandler)
+		r.Post("/email/unsubscribe", app.unsubscribeHandler)
 		//用户登陆注册
 		r.Route("/authentication", func(r chi.Router) {
 			//注册函数
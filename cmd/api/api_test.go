@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// 测试用的application,只带有给定的存储
+func newTestApplication(s *store.Storage) *application {
+	return &application{
+		store:  s,
+		logger: zap.NewNop().Sugar(),
+	}
+}
+
+// 以user的身份请求handler,pattern中的URL参数由chi解析
+func serve(t *testing.T, user *store.User, method string, pattern string, path string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Method(method, pattern, handler)
+	req := httptest.NewRequest(method, path, nil)
+	if user != nil {
+		req = req.WithContext(context.WithValue(req.Context(), userCtx, user))
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
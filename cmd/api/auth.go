@@ -12,7 +12,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/looksaw/social/internal/mailer"
+	"github.com/gorilla/websocket"
 	"github.com/looksaw/social/internal/store"
 )
 
@@ -76,28 +76,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		User:  user,
 		Token: plainToken,
 	}
-	//发送email
-	activateURL := fmt.Sprintf("%s/confirm/%s", app.config.frontEndURL, plainToken)
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activateURL,
-	}
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		//SAGA
-		app.logger.Errorw("error sending  welcome email", "error", err)
-		//Rollback
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-		app.internalServerError(w, r, err)
-		return
-	}
-	app.logger.Info("Email sent ", " status code ", status)
+	//欢迎邮件由UserRegistered事件的handler发送,发送失败会重试,不影响注册
 	//回写空的函数
 	if err := app.jsonResponse(w, http.StatusCreated, userWIthToken); err != nil {
 		app.internalServerError(w, r, err)
@@ -136,6 +115,14 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 			return
 		}
 	}
+	//重新登陆取消删除计划
+	if user.DeletionScheduledAt != nil {
+		if err := app.store.Users.CancelDeletion(r.Context(), user.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.logger.Infow("user deletion cancelled", "user_id", user.ID)
+	}
 
 	//创建一个Token
 	claims := jwt.MapClaims{
@@ -161,19 +148,11 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 // 对于发送过来的Token进行验证
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//得到头部
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			app.unauthorizedResponse(w, r, fmt.Errorf("authorization header is missing"))
-			return
-		}
-		//解析头部
-		parts := strings.Split(authHeader, " ") // authorization: Bearer <token>
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			app.unauthorizedResponse(w, r, fmt.Errorf("authorization header is malformed "))
+		token, err := bearerToken(r)
+		if err != nil {
+			app.unauthorizedResponse(w, r, err)
 			return
 		}
-		token := parts[1]
 		//验证token
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
@@ -199,3 +178,28 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// WebSocket握手时用来传递token的子协议,浏览器不能给WebSocket设置头部
+const wsTokenProtocol = "access_token"
+
+// 从请求中得到token
+// 普通请求使用Authorization头部,WebSocket握手也可以使用 Sec-WebSocket-Protocol: access_token, <token>
+func bearerToken(r *http.Request) (string, error) {
+	//得到头部
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if websocket.IsWebSocketUpgrade(r) {
+			protocols := websocket.Subprotocols(r)
+			if len(protocols) == 2 && protocols[0] == wsTokenProtocol {
+				return protocols[1], nil
+			}
+		}
+		return "", fmt.Errorf("authorization header is missing")
+	}
+	//解析头部
+	parts := strings.Split(authHeader, " ") // authorization: Bearer <token>
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", fmt.Errorf("authorization header is malformed ")
+	}
+	return parts[1], nil
+}
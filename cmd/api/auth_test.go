@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	websocket := map[string]string{
+		"Connection":            "Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		ws      bool
+		want    string
+		wantErr bool
+	}{
+		{"authorization header", map[string]string{"Authorization": "Bearer abc"}, false, "abc", false},
+		{"missing", nil, false, "", true},
+		{"wrong scheme", map[string]string{"Authorization": "Basic abc"}, false, "", true},
+		{"extra parts", map[string]string{"Authorization": "Bearer abc def"}, false, "", true},
+		{"websocket subprotocol", map[string]string{"Sec-WebSocket-Protocol": "access_token, abc"}, true, "abc", false},
+		{"header wins over subprotocol", map[string]string{"Authorization": "Bearer abc", "Sec-WebSocket-Protocol": "access_token, xyz"}, true, "abc", false},
+		{"other subprotocol", map[string]string{"Sec-WebSocket-Protocol": "chat, abc"}, true, "", true},
+		{"subprotocol without token", map[string]string{"Sec-WebSocket-Protocol": "access_token"}, true, "", true},
+		{"subprotocol on plain request", map[string]string{"Sec-WebSocket-Protocol": "access_token, abc"}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/posts/1/live", nil)
+			if tt.ws {
+				for k, v := range websocket {
+					r.Header.Set(k, v)
+				}
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got, err := bearerToken(r)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("bearerToken = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 创建评论的请求
+type CreateCommentPayload struct {
+	//Markdown源文,长度按rune计数
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// 在帖子下创建评论
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	//验证是否合规
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	comment := &store.Comment{
+		PostID:  post.ID,
+		UserID:  user.ID,
+		Content: payload.Content,
+	}
+	//写入评论
+	ctx := r.Context()
+	if err := app.store.Comment.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//通知和webhook由CommentCreated事件的handler处理
+	app.publish(ctx, postTopic(post.ID), eventCommentCreated, map[string]any{
+		"id":       comment.ID,
+		"post_id":  post.ID,
+		"user_id":  user.ID,
+		"username": user.Username,
+	})
+	comment.User = *user
+	renderComment(comment)
+	//回写
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 删除评论,评论的作者,帖子的作者以及moderator以上可以删除
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	comment, err := app.store.Comment.GetByID(ctx, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if comment.PostID != post.ID {
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+	if comment.UserID != user.ID && post.UserID != user.ID {
+		role, err := app.store.Roles.GetByName(ctx, "moderator")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if user.Role.Level < role.Level {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+	if err := app.store.Comment.Delete(ctx, comment.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.publish(ctx, postTopic(comment.PostID), eventCommentDeleted, map[string]any{
+		"id":      comment.ID,
+		"post_id": comment.PostID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 私信相关的事件
+const (
+	eventMessageCreated   = "message.created"
+	eventConversationRead = "conversation.read"
+)
+
+// 创建会话的请求,只有一个成员时是一对一会话
+type CreateConversationPayload struct {
+	MemberIDs []int64 `json:"member_ids" validate:"required,min=1,max=9,dive,gt=0"`
+	Title     *string `json:"title" validate:"omitempty,max=100"`
+}
+
+// 创建会话,一对一会话已经存在时返回已有的会话
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	conv, created, err := app.store.Conversations.Create(r.Context(), user.ID, payload.MemberIDs, payload.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		case errors.Is(err, store.ErrInvalidConversation):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrDMNotAllowed):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	if err := app.jsonResponse(w, status, conv); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 当前用户的会话,按最后一条消息的时间倒序,下一页的地址通过Link头返回
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 20, 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	convs, next, err := app.store.Conversations.GetByUserID(r.Context(), user.ID, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if next != "" {
+		w.Header().Set("Link", nextPageLink(r, next))
+	}
+	if err := app.jsonResponse(w, http.StatusOK, convs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 得到会话,包括成员的已读位置
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	convID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	conv, err := app.store.Conversations.GetByID(r.Context(), convID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, conv); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 会话中的消息,从新到旧,下一页的地址通过Link头返回
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	convID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	limit, err := parseLimit(r, 50, 100)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var before int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || before <= 0 {
+			app.badRequestResponse(w, r, store.ErrInvalidCursor)
+			return
+		}
+	}
+	user := getUserFromContext(r)
+	messages, err := app.store.Conversations.GetMessages(r.Context(), convID, user.ID, before, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if len(messages) == limit {
+		w.Header().Set("Link", nextPageLink(r, strconv.FormatInt(messages[len(messages)-1].ID, 10)))
+	}
+	if err := app.jsonResponse(w, http.StatusOK, messages); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 发送消息的请求
+type SendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+// 发送消息,并推送给会话的成员
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	convID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var payload SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	msg := &store.Message{
+		ConversationID: convID,
+		SenderID:       user.ID,
+		Content:        payload.Content,
+	}
+	ctx := r.Context()
+	if err := app.store.Conversations.Send(ctx, msg); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		case errors.Is(err, store.ErrDMNotAllowed):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	//消息内容可能超过NOTIFY的大小限制,只推送ID,客户端再拉取消息
+	app.publishToMembers(r, convID, user.ID, eventMessageCreated, map[string]any{
+		"conversation_id": convID,
+		"message_id":      msg.ID,
+		"sender_id":       user.ID,
+	})
+	if err := app.jsonResponse(w, http.StatusCreated, msg); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 已读回执的请求
+type MarkConversationReadPayload struct {
+	MessageID int64 `json:"message_id" validate:"required,gt=0"`
+}
+
+// 标记读到了哪一条消息,其他成员会收到已读回执
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	convID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var payload MarkConversationReadPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	if err := app.store.Conversations.MarkRead(r.Context(), convID, user.ID, payload.MessageID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.publishToMembers(r, convID, user.ID, eventConversationRead, map[string]any{
+		"conversation_id": convID,
+		"user_id":         user.ID,
+		"message_id":      payload.MessageID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 把事件推送给会话中除了自己以外的成员
+func (app *application) publishToMembers(r *http.Request, convID int64, senderID int64, typ string, data any) {
+	ctx := r.Context()
+	members, err := app.store.Conversations.MemberIDs(ctx, convID)
+	if err != nil {
+		app.logger.Errorw("error loading conversation members", "conversation_id", convID, "error", err)
+		return
+	}
+	for _, id := range members {
+		if id != senderID {
+			app.publish(ctx, userTopic(id), typ, data)
+		}
+	}
+}
+
+// 解析limit参数
+func parseLimit(r *http.Request, def int, max int) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return def, nil
+	}
+	l, err := strconv.Atoi(v)
+	if err != nil || l < 1 || l > max {
+		return 0, fmt.Errorf("limit must be between 1 and %d", max)
+	}
+	return l, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 摘要邮件的频率和周期
+var digestPeriods = []struct {
+	frequency string
+	period    time.Duration
+}{
+	{store.EmailDaily, time.Hour * 24},
+	{store.EmailWeekly, time.Hour * 24 * 7},
+}
+
+// 每次从数据库取出的摘要数量
+const digestBatchSize = 100
+
+// 修改邮件偏好的请求,通知类型到频率,没有的类型保持不变
+type UpdateEmailPreferencesPayload struct {
+	Preferences map[string]string `json:"preferences" validate:"required,dive,keys,oneof=follow comment mention,endkeys,oneof=immediate daily weekly off"`
+}
+
+// 得到当前用户的邮件偏好
+func (app *application) getEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	prefs, err := app.store.EmailPreferences.Get(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 修改当前用户的邮件偏好
+func (app *application) updateEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateEmailPreferencesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if err := app.store.EmailPreferences.Set(ctx, user.ID, payload.Preferences); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	prefs, err := app.store.EmailPreferences.Get(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 退订链接对应的修改
+type unsubscribeRequest struct {
+	UserID      int64             `json:"user_id"`
+	Type        string            `json:"type"`
+	Preferences map[string]string `json:"preferences"`
+}
+
+// 验证退订链接的签名,得到要做的修改,失败时已经写好了响应
+func (app *application) readUnsubscribe(w http.ResponseWriter, r *http.Request) (*unsubscribeRequest, bool) {
+	qs := r.URL.Query()
+	userID, err := strconv.ParseInt(qs.Get("user"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	kind := qs.Get("type")
+	if !mailer.VerifyUnsubscribe(app.config.mail.unsubscribeSecret, userID, kind, qs.Get("signature")) {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+	prefs := map[string]string{}
+	switch {
+	case kind == mailer.UnsubscribeAll:
+		for _, t := range store.NotificationTypes {
+			prefs[t] = store.EmailOff
+		}
+	case slices.Contains(store.NotificationTypes, kind):
+		prefs[kind] = store.EmailOff
+	default:
+		app.badRequestResponse(w, r, errors.New("unknown notification type"))
+		return nil, false
+	}
+	return &unsubscribeRequest{UserID: userID, Type: kind, Preferences: prefs}, true
+}
+
+// 退订页面,确认页面提交表单到同一个签名链接,提交后显示结果
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{if .Done}}
+<p>You will no longer receive {{if .All}}notification emails{{else}}{{.Type}} notification emails{{end}}.</p>
+{{else}}
+<p>Stop receiving {{if .All}}all notification emails{{else}}{{.Type}} notification emails{{end}}?</p>
+<form method="post" action="{{.Action}}"><button type="submit">Unsubscribe</button></form>
+{{end}}
+</body>
+</html>`))
+
+// 浏览器打开链接或者提交表单时返回页面,其他客户端返回json
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (app *application) unsubscribePageResponse(w http.ResponseWriter, r *http.Request, req *unsubscribeRequest, done bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := unsubscribePage.Execute(w, struct {
+		Type   string
+		All    bool
+		Action string
+		Done   bool
+	}{req.Type, req.Type == mailer.UnsubscribeAll, r.URL.RequestURI(), done})
+	if err != nil {
+		app.logger.Errorw("unsubscribe page", "error", err)
+	}
+}
+
+// 打开退订链接只显示确认页面,不改变任何状态
+// 邮件网关和链接预取会自动访问邮件中的链接,不能因此退订
+func (app *application) confirmUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.readUnsubscribe(w, r)
+	if !ok {
+		return
+	}
+	if wantsHTML(r) {
+		app.unsubscribePageResponse(w, r, req, false)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, req); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 通过邮件中的签名链接退订,不需要登陆
+// 用户在确认页面提交,或者邮件客户端根据List-Unsubscribe-Post一键退订,都使用POST
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.readUnsubscribe(w, r)
+	if !ok {
+		return
+	}
+	prefs := req.Preferences
+	if err := app.store.EmailPreferences.Set(r.Context(), req.UserID, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if wantsHTML(r) {
+		app.unsubscribePageResponse(w, r, req, true)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 退订链接
+func (app *application) unsubscribeURL(userID int64, kind string) string {
+	signature := mailer.SignUnsubscribe(app.config.mail.unsubscribeSecret, userID, kind)
+	return fmt.Sprintf("%s?user=%d&type=%s&signature=%s", app.config.mail.unsubscribeURL, userID, kind, signature)
+}
+
+// 通知在前端的链接,没有帖子的通知为空
+func (app *application) notificationURL(postID *int64) string {
+	if postID == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/posts/%d", app.config.frontEndURL, *postID)
+}
+
+// 给选择了立即发送的接收者发送通知邮件
+func (app *application) queueNotificationEmails(ctx context.Context, notifications []store.Notification) {
+	ids := make([]int64, 0, len(notifications))
+	for _, n := range notifications {
+		ids = append(ids, n.ID)
+	}
+	emails, err := app.store.EmailPreferences.ImmediateEmails(ctx, ids)
+	if err != nil {
+		app.logger.Errorw("error loading notification emails", "error", err)
+		return
+	}
+	for _, e := range emails {
+		summary := notificationSummary(store.NotificationGroup{
+			Type:       e.Type,
+			ActorCount: 1,
+			Actors:     []store.Actor{{ID: e.ActorID, Username: e.ActorUsername}},
+		})
+		vars := struct {
+			Username       string
+			Summary        string
+			URL            string
+			UnsubscribeURL string
+			PreferencesURL string
+		}{
+			Username:       e.Username,
+			Summary:        summary,
+			URL:            app.notificationURL(e.PostID),
+			UnsubscribeURL: app.unsubscribeURL(e.UserID, e.Type),
+			PreferencesURL: app.config.frontEndURL + "/settings/email",
+		}
+		if err := app.enqueueEmail(ctx, mailer.NotificationTemplate, e.Username, e.Email, vars); err != nil {
+			app.logger.Errorw("error queueing notification email", "notification_id", e.ID, "error", err)
+		}
+	}
+}
+
+// 后台任务:发送到期的每日和每周摘要
+func (app *application) sendDigests(ctx context.Context) error {
+	for _, p := range digestPeriods {
+		if err := app.sendDigestsFor(ctx, p.frequency, p.period); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) sendDigestsFor(ctx context.Context, frequency string, period time.Duration) error {
+	now := time.Now()
+	//提前一个检查间隔算作到期,避免发送时间每个周期向后漂移
+	due := now.Add(-period + app.config.mail.digestInterval)
+	var afterID int64
+	for {
+		digests, err := app.store.EmailPreferences.DueDigests(ctx, frequency, due, now.Add(-period), afterID, digestBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, d := range digests {
+			afterID = d.UserID
+			//入队失败的用户下次检查时重试
+			if err := app.sendDigest(ctx, d, frequency, now); err != nil {
+				app.logger.Errorw("error queueing digest", "user_id", d.UserID, "frequency", frequency, "error", err)
+			}
+		}
+		if len(digests) < digestBatchSize {
+			return nil
+		}
+	}
+}
+
+// 摘要中的一项
+type digestItem struct {
+	Summary string
+	URL     string
+}
+
+// 把一封摘要邮件加入发送队列,成功后记录发送时间
+func (app *application) sendDigest(ctx context.Context, d store.Digest, frequency string, sentAt time.Time) error {
+	items := make([]digestItem, 0, len(d.Groups))
+	for _, g := range d.Groups {
+		items = append(items, digestItem{
+			Summary: notificationSummary(g),
+			URL:     app.notificationURL(g.PostID),
+		})
+	}
+	vars := struct {
+		Username       string
+		Period         string
+		Since          string
+		Items          []digestItem
+		UnsubscribeURL string
+		PreferencesURL string
+	}{
+		Username:       d.Username,
+		Period:         frequency,
+		Since:          d.Since.Format(time.RFC1123),
+		Items:          items,
+		UnsubscribeURL: app.unsubscribeURL(d.UserID, mailer.UnsubscribeAll),
+		PreferencesURL: app.config.frontEndURL + "/settings/email",
+	}
+	if err := app.enqueueEmail(ctx, mailer.DigestTemplate, d.Username, d.Email, vars); err != nil {
+		return err
+	}
+	return app.store.EmailPreferences.MarkDigestSent(ctx, d.UserID, frequency, sentAt)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 记录退订修改的邮件偏好存储
+type fakeEmailPreferences struct {
+	*store.EmailPreferenceStore
+	userID int64
+	prefs  map[string]string
+}
+
+func (f *fakeEmailPreferences) Set(ctx context.Context, userID int64, prefs map[string]string) error {
+	f.userID, f.prefs = userID, prefs
+	return nil
+}
+
+func TestEmailHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+		want mailer.Header
+	}{
+		{"notification", map[string]any{"UnsubscribeURL": "https://x/u"}, mailer.UnsubscribeHeader("https://x/u")},
+		{"empty url", map[string]any{"UnsubscribeURL": ""}, nil},
+		{"no url", map[string]any{"Username": "alice"}, nil},
+		{"not a map", struct{ UnsubscribeURL string }{"https://x/u"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := emailHeader(tt.data); !maps.Equal(got, tt.want) {
+				t.Errorf("emailHeader = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	const secret = "unsubscribe_test"
+	link := func(userID int64, kind string) string {
+		return fmt.Sprintf("/unsubscribe?user=%d&type=%s&signature=%s", userID, kind, mailer.SignUnsubscribe(secret, userID, kind))
+	}
+	allOff := map[string]string{}
+	for _, typ := range store.NotificationTypes {
+		allOff[typ] = store.EmailOff
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		accept string
+		status int
+		//POST写入的偏好,nil表示不能修改
+		prefs map[string]string
+		body  string
+	}{
+		{"GET shows a form", http.MethodGet, link(7, "all"), "text/html", http.StatusOK, nil, `<form method="post" action="` + strings.ReplaceAll(link(7, "all"), "&", "&amp;") + `">`},
+		{"GET as JSON", http.MethodGet, link(7, "comment"), "application/json", http.StatusOK, nil, `"type":"comment"`},
+		{"POST from the page", http.MethodPost, link(7, "all"), "text/html", http.StatusOK, allOff, "You will no longer receive notification emails"},
+		{"POST one-click", http.MethodPost, link(7, "comment"), "", http.StatusOK, map[string]string{"comment": store.EmailOff}, `"comment":"off"`},
+		{"bad signature", http.MethodPost, link(7, "all") + "0", "", http.StatusForbidden, nil, ""},
+		{"signature for another user", http.MethodPost, strings.Replace(link(7, "all"), "user=7", "user=8", 1), "", http.StatusForbidden, nil, ""},
+		{"unknown type", http.MethodPost, link(7, "likes"), "", http.StatusBadRequest, nil, ""},
+		{"invalid user", http.MethodGet, "/unsubscribe?user=x&type=all", "", http.StatusBadRequest, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := &fakeEmailPreferences{}
+			app := newTestApplication(&store.Storage{EmailPreferences: prefs})
+			app.config.mail.unsubscribeSecret = secret
+			handler := app.confirmUnsubscribeHandler
+			if tt.method == http.MethodPost {
+				handler = app.unsubscribeHandler
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader("List-Unsubscribe=One-Click"))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, r)
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body)
+			}
+			if !maps.Equal(prefs.prefs, tt.prefs) {
+				t.Errorf("saved %v, want %v", prefs.prefs, tt.prefs)
+			}
+			if tt.prefs != nil && prefs.userID != 7 {
+				t.Errorf("saved for user %d, want 7", prefs.userID)
+			}
+			if body := rr.Body.String(); !strings.Contains(body, tt.body) {
+				t.Errorf("body missing %q:\n%s", tt.body, body)
+			}
+		})
+	}
+}
@@ -44,6 +44,30 @@ func (app *application) unauthorizedBasicResponse(w http.ResponseWriter, r *http
 
 // forbidden
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
-	app.logger.Warnf("forbidden error :", "method", r.Method, "path", r.URL.Path, "err", err)
+	app.logger.Warnw("forbidden error :", "method", r.Method, "path", r.URL.Path)
 	writeJSONError(w, http.StatusForbidden, "forbidden")
 }
+
+// 缺少条件请求头
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("precondition required error :", "method", r.Method, "path", r.URL.Path, "err", err)
+	writeJSONError(w, http.StatusPreconditionRequired, err.Error())
+}
+
+// 条件请求不满足
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("precondition failed error :", "method", r.Method, "path", r.URL.Path, "err", err)
+	writeJSONError(w, http.StatusPreconditionFailed, err.Error())
+}
+
+// 上传的文件太大
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("payload too large error :", "method", r.Method, "path", r.URL.Path, "err", err)
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+// 不支持的文件类型
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unsupported media type error :", "method", r.Method, "path", r.URL.Path, "err", err)
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 常用的Cache-Control策略,在mount中按路由选择
+const (
+	//需要认证的内容,每次都要向服务器验证
+	cachePrivateRevalidate = "private, no-cache"
+	//变化不频繁的内容,允许客户端缓存一分钟
+	cachePrivateShort = "private, max-age=60"
+)
+
+// 设置Cache-Control的中间件
+func (app *application) cacheControl(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", policy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// 帖子的ETag,由ID和乐观锁的版本号组成
+func postETag(post *store.Post) string {
+	return fmt.Sprintf(`"%d-%d"`, post.ID, post.Version)
+}
+
+// GET帖子时的ETag,在版本号之后附带评论,投票,附件和提及的摘要
+// 这些变化不会修改版本号,例如新评论,新的投票,附件处理完成
+func postRepresentationETag(post *store.Post) (string, error) {
+	digest, err := digestJSON(struct {
+		Comments    []store.Comment
+		Poll        *store.Poll
+		Attachments []store.Media
+		Mentions    []store.Mention
+	}{post.Comments, post.Poll, post.Attachments, post.Mentions})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%d-%d-%s"`, post.ID, post.Version, digest), nil
+}
+
+// If-Match使用强比较,弱ETag永远不匹配
+// 只比较ID和版本号,评论的变化不算编辑冲突
+func ifMatch(r *http.Request, post *store.Post) bool {
+	etag := postETag(post)
+	prefix := strings.TrimSuffix(etag, `"`) + "-"
+	for _, candidate := range strings.Split(r.Header.Get("If-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag || strings.HasPrefix(candidate, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据返回的数据计算弱ETag
+func weakETag(data any) (string, error) {
+	digest, err := digestJSON(data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`W/"%s"`, digest), nil
+}
+
+func digestJSON(data any) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// 条件GET:设置ETag和Last-Modified,客户端的缓存仍然有效时写入304并返回true
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	//有If-None-Match时忽略If-Modified-Since
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakMatch(candidate, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// 弱比较,忽略W/前缀
+func weakMatch(a string, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// 解析数据库返回的时间字符串,失败时返回零值
+func parseTimestamp(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
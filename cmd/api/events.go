@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/store"
+	"github.com/looksaw/social/internal/webhook"
+)
+
+// 注册领域事件的handler
+// 每个handler只做一次写入,失败重试时不会重复执行已经成功的handler
+func (app *application) registerEventHandlers() {
+	//邮件
+	app.outbox.Handle(store.EventUserRegistered, "welcome-mail", app.sendWelcomeMail)
+	//通知
+	app.outbox.Handle(store.EventPostCreated, "mention-notifications", app.notifyPostMentions)
+	app.outbox.Handle(store.EventPostUpdated, "mention-notifications", app.notifyPostMentions)
+	app.outbox.Handle(store.EventUserFollowed, "follow-notification", app.notifyFollow)
+	app.outbox.Handle(store.EventCommentCreated, "comment-notification", app.notifyComment)
+	app.outbox.Handle(store.EventCommentCreated, "mention-notifications", app.notifyCommentMentions)
+	//webhook
+	app.outbox.Handle(store.EventPostCreated, "webhooks", app.postCreatedWebhook)
+	app.outbox.Handle(store.EventUserFollowed, "webhooks", app.userFollowedWebhook)
+	app.outbox.Handle(store.EventCommentCreated, "webhooks", app.commentCreatedWebhook)
+	//个人数据导出
+	app.outbox.Handle(store.EventExportRequested, "export", app.buildExport)
+}
+
+// 分发失败只记录日志,事件稍后重试
+func (app *application) logEventError(ev store.OutboxEvent, handler string, err error) {
+	app.logger.Errorw("event handler failed", "event_id", ev.ID, "type", ev.Type, "handler", handler, "attempt", ev.Attempts+1, "error", err)
+}
+
+// 后台任务:删除处理完的事件
+func (app *application) purgeOutbox(ctx context.Context) error {
+	return app.store.Outbox.Purge(ctx, time.Now().Add(-app.config.outbox.retention))
+}
+
+// 队列中的欢迎邮件,激活链接在发送时才生成
+type welcomeMail struct {
+	UserID   int64
+	Username string
+}
+
+// 把欢迎邮件加入发送队列
+func (app *application) sendWelcomeMail(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.UserRegistered
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	return app.enqueueEmail(ctx, mailer.UserWelcomeTemplate, e.Username, e.Email, welcomeMail{
+		UserID:   e.UserID,
+		Username: e.Username,
+	})
+}
+
+// 发送欢迎邮件时新建一个邀请,明文token只出现在邮件中
+// 注册时的token只返回给了客户端,数据库中只有hash,所以不能复用
+// 用户已经激活或者已经删除时返回nil,不再发送
+func (app *application) welcomeMailData(ctx context.Context, data json.RawMessage) (any, error) {
+	var m welcomeMail
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	ok, err := app.store.Users.CreateInvitation(ctx, m.UserID, hex.EncodeToString(hash[:]), app.config.mail.exp)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      m.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontEndURL, plainToken),
+	}, nil
+}
+
+// 通知帖子正文中提及的人,编辑时已经通知过的不会重复通知
+func (app *application) notifyPostMentions(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.PostEvent
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	all, err := app.store.Mentions.GetByPostIDs(ctx, []int64{e.PostID})
+	if err != nil {
+		return err
+	}
+	mentions := make([]store.Mention, 0, len(all))
+	for _, m := range all {
+		if m.CommentID == nil {
+			mentions = append(mentions, m)
+		}
+	}
+	return app.notifyMentions(ctx, e.UserID, mentions)
+}
+
+// 通知被关注的人
+func (app *application) notifyFollow(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.UserFollowed
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	return app.notify(ctx, store.Notification{
+		UserID:  e.UserID,
+		ActorID: e.FollowerID,
+		Type:    store.NotificationFollow,
+	})
+}
+
+// 通知帖子的作者有新评论
+func (app *application) notifyComment(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.CommentCreated
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	post, err := app.eventPost(ctx, e.PostID)
+	if err != nil || post == nil {
+		return err
+	}
+	return app.notify(ctx, store.Notification{
+		UserID:    post.UserID,
+		ActorID:   e.UserID,
+		Type:      store.NotificationComment,
+		PostID:    &post.ID,
+		CommentID: &e.CommentID,
+	})
+}
+
+// 通知评论中提及的人,帖子的作者已经收到评论通知就不再收到提及通知
+func (app *application) notifyCommentMentions(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.CommentCreated
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	post, err := app.eventPost(ctx, e.PostID)
+	if err != nil || post == nil {
+		return err
+	}
+	all, err := app.store.Mentions.GetByPostIDs(ctx, []int64{e.PostID})
+	if err != nil {
+		return err
+	}
+	mentions := make([]store.Mention, 0, len(all))
+	for _, m := range all {
+		if m.CommentID != nil && *m.CommentID == e.CommentID {
+			mentions = append(mentions, m)
+		}
+	}
+	return app.notifyMentions(ctx, e.UserID, mentions, post.UserID)
+}
+
+// 只有公开的帖子投递给外部系统
+func (app *application) postCreatedWebhook(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.PostEvent
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	post, err := app.eventPost(ctx, e.PostID)
+	if err != nil || post == nil || post.Visibility != store.VisibilityPublic {
+		return err
+	}
+	return app.enqueueWebhook(ctx, webhook.EventPostCreated, map[string]any{
+		"id":         post.ID,
+		"user_id":    post.UserID,
+		"title":      post.Title,
+		"content":    post.Content,
+		"tags":       post.Tags,
+		"created_at": post.CreatedAt,
+	})
+}
+
+func (app *application) userFollowedWebhook(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.UserFollowed
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	return app.enqueueWebhook(ctx, webhook.EventUserFollowed, map[string]any{
+		"follower_id": e.FollowerID,
+		"user_id":     e.UserID,
+	})
+}
+
+// 只有公开帖子下的评论投递给外部系统
+func (app *application) commentCreatedWebhook(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.CommentCreated
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	post, err := app.eventPost(ctx, e.PostID)
+	if err != nil || post == nil || post.Visibility != store.VisibilityPublic {
+		return err
+	}
+	comment, err := app.store.Comment.GetByID(ctx, e.CommentID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return app.enqueueWebhook(ctx, webhook.EventCommentCreated, map[string]any{
+		"id":         comment.ID,
+		"post_id":    comment.PostID,
+		"user_id":    comment.UserID,
+		"content":    comment.Content,
+		"created_at": comment.CreatedAt,
+	})
+}
+
+// 得到事件中已经发布的帖子,处理事件之前帖子可能已经被删除或者撤回,这时返回nil
+func (app *application) eventPost(ctx context.Context, postID int64) (*store.Post, error) {
+	post, err := app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if post.Status != store.PostStatusPublished {
+		return nil, nil
+	}
+	return post, nil
+}
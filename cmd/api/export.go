@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/looksaw/social/internal/export"
+	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 申请导出个人数据,导出在后台完成后通过邮件发送下载链接
+// 上一次申请还没有完成时返回409
+func (app *application) requestExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if err := app.store.Exports.Request(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrExportPending):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 发件箱的handler:生成ZIP文件并把下载链接加入邮件队列
+// 失败时事件稍后重试,用户已经删除时不再导出
+func (app *application) buildExport(ctx context.Context, ev store.OutboxEvent) error {
+	var e store.ExportRequested
+	if err := json.Unmarshal(ev.Payload, &e); err != nil {
+		return err
+	}
+	user, err := app.store.Users.GetByID(ctx, e.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	data, err := app.store.Exports.Collect(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for i := range data.Media {
+		setMediaURLs(&data.Media[i])
+	}
+	if err := os.MkdirAll(app.config.export.dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.zip", user.ID, uuid.New().String())
+	if err := writeExportFile(filepath.Join(app.config.export.dir, name), data); err != nil {
+		return err
+	}
+	m := exportMail{
+		Username: user.Username,
+		File:     name,
+		Expires:  time.Now().Add(app.config.export.exp).Unix(),
+	}
+	return app.enqueueEmail(ctx, mailer.UserExportTemplate, user.Username, user.Email, m)
+}
+
+// 队列中的导出邮件,签名的下载链接在发送时才生成
+type exportMail struct {
+	Username string
+	File     string
+	Expires  int64
+}
+
+// 签名的下载链接
+func (app *application) exportMailData(data json.RawMessage) (any, error) {
+	var m exportMail
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	expires := time.Unix(m.Expires, 0)
+	signature := export.Sign(app.config.export.secret, m.File, expires)
+	return struct {
+		Username    string
+		DownloadURL string
+		ExpiresAt   string
+	}{
+		Username:    m.Username,
+		DownloadURL: fmt.Sprintf("%s/%s?expires=%d&signature=%s", app.config.export.downloadURL, m.File, m.Expires, signature),
+		ExpiresAt:   expires.Format(time.RFC1123),
+	}, nil
+}
+
+// 先写入临时文件再重命名,避免下载到写了一半的文件
+func writeExportFile(path string, data *store.UserExport) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := export.WriteZip(f, data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 通过签名链接下载导出的文件
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	qs := r.URL.Query()
+	expires, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if name != filepath.Base(name) || !export.Verify(app.config.export.secret, name, expires, qs.Get("signature")) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	path := filepath.Join(app.config.export.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, path)
+}
+
+// 后台任务:删除已经过期的导出文件
+func (app *application) cleanupExports(ctx context.Context) error {
+	entries, err := os.ReadDir(app.config.export.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > app.config.export.exp {
+			if err := os.Remove(filepath.Join(app.config.export.dir, entry.Name())); err != nil {
+				app.logger.Errorw("error removing export", "name", entry.Name(), "error", err)
+			}
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/looksaw/social/internal/store"
 )
@@ -28,11 +30,51 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	//得到ctx
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(1), fq)
+	user := getUserFromContext(r)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if err := app.attachFeedExtras(ctx, feed, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, feed)
+}
+
+// 给帖子列表填充提及,附件和投票
+func (app *application) attachFeedExtras(ctx context.Context, feed []store.PostWithMetadata, viewerID int64) error {
+	//得到提及
+	if err := app.attachFeedMentions(ctx, feed); err != nil {
+		return err
+	}
+	//得到附件
+	posts := make([]*store.Post, 0, len(feed))
+	for i := range feed {
+		posts = append(posts, &feed[i].Post)
+	}
+	if err := app.attachPostMedia(ctx, posts); err != nil {
+		return err
+	}
+	//得到投票
+	return app.attachPolls(ctx, posts, viewerID)
+}
+
+// 回写帖子列表,支持条件GET
+func (app *application) feedResponse(w http.ResponseWriter, r *http.Request, feed []store.PostWithMetadata) {
+	for i := range feed {
+		renderPost(&feed[i].Post)
+	}
+	//条件GET,帖子离开feed时没有对应的更新时间,只使用ETag
+	etag, err := weakETag(feed)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, etag, time.Time{}) {
+		return
+	}
 	//回写
 	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
 		app.internalServerError(w, r, err)
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// 周期性的执行后台任务,直到ctx被取消
+func (app *application) runPeriodic(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				app.logger.Errorw("background job failed", "job", name, "error", err)
+			}
+		}
+	}
+}
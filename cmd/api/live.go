@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	//单条消息的写超时
+	liveWriteWait = time.Second * 10
+	//超过这个时间没有收到pong就断开
+	livePongWait = time.Second * 60
+	//ping的间隔,必须小于livePongWait
+	livePingPeriod = livePongWait * 9 / 10
+	//客户端只会发送控制帧
+	liveMaxMessage = 512
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{wsTokenProtocol},
+	//认证使用token而不是cookie,和CORS一样允许所有来源
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// 推送给客户端的消息
+type liveMessage struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// 帖子的实时评论,推送新评论,删除评论以及帖子的编辑和删除
+// 每个连接有固定大小的缓冲,消费太慢时以1013关闭,客户端稍后重连
+func (app *application) livePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	//Upgrade失败时已经写入了错误
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	sub := app.hub.Subscribe(postTopic(post.ID))
+	defer sub.Close()
+
+	//读取客户端的消息,只为了处理pong和关闭
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(liveMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(livePongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(livePongWait))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(livePingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+		case ev, ok := <-sub.Events():
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client is too slow")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(liveWriteWait))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteJSON(liveMessage{Type: ev.Type, Data: ev.Data}); err != nil {
+				app.logger.Infow("live connection closed", "post_id", post.ID, "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 把邮件加入发送队列,由后台的worker发送
+func (app *application) enqueueEmail(ctx context.Context, template string, username string, email string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	job := &store.EmailJob{
+		Template: template,
+		Username: username,
+		Email:    email,
+		Data:     raw,
+	}
+	if err := app.store.EmailJobs.Enqueue(ctx, job); err != nil {
+		return err
+	}
+	app.logger.Infow("email queued", "job_id", job.ID, "template", template)
+	return nil
+}
+
+// 后台任务:发送队列中到期的邮件,直到没有到期的邮件
+// 启动多个就是一个worker池,任务通过SKIP LOCKED分给不同的worker
+func (app *application) processEmailJobs(ctx context.Context) error {
+	//领取之后在这段时间内没有记录结果的任务会被重新领取
+	lease := time.Minute * 5
+	for {
+		job, err := app.store.EmailJobs.ClaimNext(ctx, lease)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		app.sendEmailJob(ctx, job)
+		if err := app.store.EmailJobs.RecordAttempt(ctx, job); err != nil {
+			return err
+		}
+	}
+}
+
+// 渲染模板用的变量,激活链接和下载链接在发送时才生成,不写入队列
+// 返回nil表示不需要再发送
+func (app *application) emailData(ctx context.Context, job *store.EmailJob) (any, error) {
+	switch job.Template {
+	case mailer.UserWelcomeTemplate:
+		return app.welcomeMailData(ctx, job.Data)
+	case mailer.UserExportTemplate:
+		return app.exportMailData(job.Data)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(job.Data, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 发送一封邮件,失败时按指数退避安排下一次重试,次数用完进入死信
+func (app *application) sendEmailJob(ctx context.Context, job *store.EmailJob) {
+	data, err := app.emailData(ctx, job)
+	if err == nil {
+		err = app.sendEmail(job, data)
+	}
+	job.NextAttemptAt = time.Now()
+	job.LastError = nil
+	if err == nil {
+		job.Status = store.EmailJobSent
+		return
+	}
+	msg := err.Error()
+	job.LastError = &msg
+	attempt := job.Attempts + 1
+	if attempt >= mailer.MaxQueueAttempts {
+		job.Status = store.EmailJobDead
+		app.logger.Errorw("email dead-lettered", "job_id", job.ID, "template", job.Template, "attempts", attempt, "error", err)
+		return
+	}
+	job.Status = store.EmailJobPending
+	job.NextAttemptAt = time.Now().Add(mailer.Backoff(attempt))
+	app.logger.Warnw("email send failed", "job_id", job.ID, "template", job.Template, "attempt", attempt, "error", err)
+}
+
+// data为nil时跳过,任务同样记为已发送
+func (app *application) sendEmail(job *store.EmailJob, data any) error {
+	if data == nil {
+		app.logger.Infow("email skipped", "job_id", job.ID, "template", job.Template)
+		return nil
+	}
+	isProdEnv := app.config.env == "production"
+	status, err := app.mailer.Send(job.Template, job.Username, job.Email, data, emailHeader(data), !isProdEnv)
+	if err != nil {
+		return err
+	}
+	app.logger.Infow("email sent", "job_id", job.ID, "template", job.Template, "status", status)
+	return nil
+}
+
+// 带有退订链接的邮件同时加上一键退订的邮件头
+func emailHeader(data any) mailer.Header {
+	vars, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+	url, ok := vars["UnsubscribeURL"].(string)
+	if !ok || url == "" {
+		return nil
+	}
+	return mailer.UnsubscribeHeader(url)
+}
+
+// 后台任务:删除已经发送的邮件任务
+func (app *application) purgeEmailJobs(ctx context.Context) error {
+	return app.store.EmailJobs.PurgeSent(ctx, time.Now().Add(-app.config.mail.jobRetention))
+}
+
+// 死信中的邮件,按时间倒序,下一页的地址通过Link头返回
+func (app *application) getDeadEmailJobsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 20, 100)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var before int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || before <= 0 {
+			app.badRequestResponse(w, r, store.ErrInvalidCursor)
+			return
+		}
+	}
+	jobs, err := app.store.EmailJobs.GetDead(r.Context(), before, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if len(jobs) == limit {
+		w.Header().Set("Link", nextPageLink(r, strconv.FormatInt(jobs[len(jobs)-1].ID, 10)))
+	}
+	if err := app.jsonResponse(w, http.StatusOK, jobs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 把死信中的邮件放回队列
+func (app *application) retryEmailJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	job, err := app.store.EmailJobs.Retry(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
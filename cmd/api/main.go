@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/looksaw/social/internal/auth"
+	"github.com/looksaw/social/internal/blob"
 	"github.com/looksaw/social/internal/db"
 	"github.com/looksaw/social/internal/env"
 	"github.com/looksaw/social/internal/mailer"
+	"github.com/looksaw/social/internal/outbox"
+	"github.com/looksaw/social/internal/pubsub"
 	"github.com/looksaw/social/internal/store"
+	"github.com/looksaw/social/internal/webhook"
 	"go.uber.org/zap"
 )
 
@@ -62,6 +68,14 @@ func main() {
 			mailTrip: mailTripConfig{
 				apiKey: env.GetString("MAILTRIP_API_KEY", ""),
 			},
+			//通知邮件
+			digestInterval:    env.GetDuration("EMAIL_DIGEST_INTERVAL", time.Hour),
+			unsubscribeSecret: env.GetString("EMAIL_UNSUBSCRIBE_SECRET", "example"),
+			unsubscribeURL:    env.GetString("EMAIL_UNSUBSCRIBE_URL", "http://localhost:8080/v1/email/unsubscribe"),
+			//发送队列
+			workers:      env.GetInt("MAIL_WORKERS", 2),
+			pollInterval: env.GetDuration("MAIL_POLL_INTERVAL", time.Second*2),
+			jobRetention: env.GetDuration("MAIL_JOB_RETENTION", time.Hour*24*7),
 		},
 		//认证的基本设置
 		auth: authConfig{
@@ -75,10 +89,65 @@ func main() {
 				iss:    "gophersocial",
 			},
 		},
+		//账户删除设置
+		deletion: deletionConfig{
+			grace:    env.GetDuration("USER_DELETION_GRACE", time.Hour*24*30),
+			policy:   env.GetString("USER_DELETION_POLICY", string(store.DeletionAnonymize)),
+			interval: env.GetDuration("USER_DELETION_INTERVAL", time.Hour),
+		},
+		//数据导出设置
+		export: exportConfig{
+			dir:         env.GetString("EXPORT_DIR", "./tmp/exports"),
+			exp:         env.GetDuration("EXPORT_LINK_EXP", time.Hour*24),
+			secret:      env.GetString("EXPORT_SIGNING_SECRET", "example"),
+			downloadURL: env.GetString("EXPORT_DOWNLOAD_URL", "http://localhost:8080/v1/users/exports"),
+		},
+		//定时发布设置
+		scheduler: schedulerConfig{
+			publishInterval: env.GetDuration("POST_PUBLISH_INTERVAL", time.Second*30),
+		},
+		//回收站设置
+		trash: trashConfig{
+			retention: env.GetDuration("TRASH_RETENTION", time.Hour*24*30),
+			interval:  env.GetDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+		//媒体文件设置
+		media: mediaConfig{
+			maxBytes:  int64(env.GetInt("MEDIA_MAX_BYTES", 10<<20)),
+			maxPixels: env.GetInt("MEDIA_MAX_PIXELS", 40_000_000),
+			workers:   env.GetInt("MEDIA_WORKERS", 4),
+			backend:   env.GetString("BLOB_BACKEND", "local"),
+			dir:       env.GetString("BLOB_DIR", "./tmp/blobs"),
+			s3: s3Config{
+				endpoint:  env.GetString("S3_ENDPOINT", "http://localhost:9000"),
+				region:    env.GetString("S3_REGION", "us-east-1"),
+				bucket:    env.GetString("S3_BUCKET", "social"),
+				accessKey: env.GetString("S3_ACCESS_KEY", "minioadmin"),
+				secretKey: env.GetString("S3_SECRET_KEY", "minioadmin"),
+			},
+			unattachedTTL: env.GetDuration("MEDIA_UNATTACHED_TTL", time.Hour*24),
+		},
+		//webhook设置
+		webhook: webhookConfig{
+			pollInterval: env.GetDuration("WEBHOOK_POLL_INTERVAL", time.Second*5),
+			timeout:      env.GetDuration("WEBHOOK_TIMEOUT", time.Second*10),
+			batchSize:    env.GetInt("WEBHOOK_BATCH_SIZE", 20),
+		},
+		//领域事件设置
+		outbox: outboxConfig{
+			pollInterval: env.GetDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			retention:    env.GetDuration("OUTBOX_RETENTION", time.Hour*24*7),
+		},
 	}
 	//初始化结构化logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
+	//检查删除策略
+	switch store.DeletionPolicy(cfg.deletion.policy) {
+	case store.DeletionCascade, store.DeletionAnonymize:
+	default:
+		logger.Fatalf("unknown user deletion policy %q", cfg.deletion.policy)
+	}
 	//初始化db
 	db, err := db.New(
 		cfg.db.addr,
@@ -102,6 +171,19 @@ func main() {
 	}
 	//初始化存储
 	store := store.NewPostgreStorage(db)
+	//媒体文件的存储
+	var blobs blob.BlobStore
+	switch cfg.media.backend {
+	case "s3":
+		blobs, err = blob.NewS3Store(cfg.media.s3.endpoint, cfg.media.s3.region, cfg.media.s3.bucket, cfg.media.s3.accessKey, cfg.media.s3.secretKey)
+	case "local":
+		blobs, err = blob.NewLocalStore(cfg.media.dir)
+	default:
+		err = fmt.Errorf("unknown blob backend %q", cfg.media.backend)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
 	//初始化application
 	app := &application{
 		config:        cfg,
@@ -109,6 +191,44 @@ func main() {
 		logger:        logger,
 		mailer:        mailtrap,
 		authenticator: jwtAuthenticator,
+		blobs:         blobs,
+		mediaQueue:    make(chan int64, 256),
+		webhooks:      webhook.NewClient(cfg.webhook.timeout),
+	}
+	//实时推送,事件经过Postgres的LISTEN/NOTIFY广播
+	hub := pubsub.NewHub()
+	bridge := pubsub.NewPGBridge(cfg.db.addr, db, hub, func(err error) {
+		logger.Errorw("event bridge error", "error", err)
+	})
+	app.hub = hub
+	app.events = bridge
+	//领域事件,和状态变化在同一个事务中写入,之后分发给进程内的handler
+	app.outbox = outbox.NewDispatcher(store.Outbox, time.Minute*5, 50, app.logEventError)
+	app.registerEventHandlers()
+	//后台任务
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.runPeriodic(ctx, "user-deletion", cfg.deletion.interval, app.purgeDeletedUsers)
+	go app.runPeriodic(ctx, "export-cleanup", time.Hour, app.cleanupExports)
+	go app.runPeriodic(ctx, "post-publisher", cfg.scheduler.publishInterval, app.publishScheduledPosts)
+	go app.runPeriodic(ctx, "trash-purge", cfg.trash.interval, app.purgeTrash)
+	go app.runPeriodic(ctx, "media-requeue", time.Minute, app.requeueStalledMedia)
+	go app.runPeriodic(ctx, "media-cleanup", time.Hour, app.cleanupMedia)
+	go app.runPeriodic(ctx, "email-digests", cfg.mail.digestInterval, app.sendDigests)
+	go app.runPeriodic(ctx, "webhook-deliveries", cfg.webhook.pollInterval, app.deliverWebhooks)
+	go app.runPeriodic(ctx, "outbox-dispatch", cfg.outbox.pollInterval, app.outbox.Dispatch)
+	go app.runPeriodic(ctx, "outbox-purge", time.Hour, app.purgeOutbox)
+	go func() {
+		if err := bridge.Run(ctx); err != nil {
+			logger.Errorw("event bridge stopped", "error", err)
+		}
+	}()
+	for i := 0; i < cfg.media.workers; i++ {
+		go app.runMediaWorker(ctx)
+	}
+	for i := 0; i < cfg.mail.workers; i++ {
+		go app.runPeriodic(ctx, "mail-worker", cfg.mail.pollInterval, app.processEmailJobs)
 	}
+	go app.runPeriodic(ctx, "mail-purge", time.Hour, app.purgeEmailJobs)
 	logger.Fatal(app.run(app.mount()))
 }
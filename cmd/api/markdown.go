@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/looksaw/social/internal/markdown"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 回写之前把帖子和评论的Markdown渲染成HTML,store只负责读写
+func renderPost(post *store.Post) {
+	post.ContentHTML = markdown.Render(post.Content)
+	for i := range post.Comments {
+		renderComment(&post.Comments[i])
+	}
+}
+
+func renderComment(comment *store.Comment) {
+	comment.ContentHTML = markdown.Render(comment.Content)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/looksaw/social/internal/imaging"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 允许上传的文件类型,通过文件内容判断而不是相信客户端
+var allowedMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"video/mp4":  true,
+}
+
+// 上传媒体文件,multipart表单中的file字段
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	maxBytes := app.config.media.maxBytes
+	//multipart的其他部分留一点余量
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	//找到file字段
+	var part io.Reader
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if p.FormName() == "file" {
+			part = p
+			break
+		}
+	}
+	if part == nil {
+		app.badRequestResponse(w, r, errors.New("file field is required"))
+		return
+	}
+	//先写入临时文件,得到大小之后再上传
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, io.LimitReader(part, maxBytes+1))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if size > maxBytes {
+		app.payloadTooLargeResponse(w, r, fmt.Errorf("file must be at most %d bytes", maxBytes))
+		return
+	}
+	//嗅探文件类型
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		app.internalServerError(w, r, err)
+		return
+	}
+	mimeType := http.DetectContentType(head[:n])
+	if !allowedMediaTypes[mimeType] {
+		app.unsupportedMediaTypeResponse(w, r, fmt.Errorf("unsupported media type %s", mimeType))
+		return
+	}
+	//图片只读头部检查尺寸,真正的解码交给后台
+	isImage := strings.HasPrefix(mimeType, "image/")
+	if isImage {
+		if _, _, err := imaging.CheckDimensions(io.NewSectionReader(tmp, 0, size), app.config.media.maxPixels); err != nil {
+			switch {
+			case errors.Is(err, imaging.ErrTooManyPixels):
+				app.payloadTooLargeResponse(w, r, fmt.Errorf("image must be at most %d pixels across at most %d frames", app.config.media.maxPixels, imaging.MaxFrames))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//写入blob存储
+	ctx := r.Context()
+	media := &store.Media{
+		UserID:     user.ID,
+		StorageKey: fmt.Sprintf("media/%d/%s", user.ID, uuid.New().String()),
+		MimeType:   mimeType,
+		Size:       size,
+		Status:     store.MediaReady,
+	}
+	if isImage {
+		media.Status = store.MediaPending
+	}
+	if err := app.blobs.Put(ctx, media.StorageKey, tmp, size, mimeType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Media.Create(ctx, media); err != nil {
+		if err := app.blobs.Delete(ctx, media.StorageKey); err != nil {
+			app.logger.Errorw("error deleting blob", "key", media.StorageKey, "error", err)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	setMediaURLs(media)
+	//图片返回202,客户端根据status判断是否处理完成
+	status := http.StatusCreated
+	if isImage {
+		app.enqueueMedia(media.ID)
+		status = http.StatusAccepted
+	}
+	//回写
+	if err := app.jsonResponse(w, status, media); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 下载媒体文件,挂在帖子上的按帖子的可见范围判断,未使用的只有上传者能看到
+// variant=thumbnail或medium下载处理后的版本
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	mediaID, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	media, err := app.store.Media.GetByID(ctx, mediaID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	allowed := media.UserID == user.ID
+	if !allowed && media.PostID != nil {
+		post, err := app.store.Posts.GetByID(ctx, *media.PostID)
+		if err == nil {
+			allowed, err = app.canViewPost(ctx, post, user)
+		}
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	//处理完成之前原文件还带着元数据,只有上传者能看到
+	if !allowed || (media.Status != store.MediaReady && media.UserID != user.ID) {
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+	key := media.StorageKey
+	switch variant := r.URL.Query().Get("variant"); variant {
+	case "":
+	case "thumbnail", "medium":
+		if media.Status != store.MediaReady || media.ThumbnailKey == nil || media.MediumKey == nil {
+			app.notFound(w, r, fmt.Errorf("media %d has no %s rendition", media.ID, variant))
+			return
+		}
+		key = *media.ThumbnailKey
+		if variant == "medium" {
+			key = *media.MediumKey
+		}
+	default:
+		app.badRequestResponse(w, r, fmt.Errorf("unknown variant %q", variant))
+		return
+	}
+	rc, err := app.blobs.Get(ctx, key)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer rc.Close()
+	//处理后的版本的类型由key的扩展名决定
+	if key == media.StorageKey {
+		w.Header().Set("Content-Type", media.MimeType)
+		w.Header().Set("Content-Length", strconv.FormatInt(media.Size, 10))
+	} else {
+		w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if _, err := io.Copy(w, rc); err != nil {
+		app.logger.Errorw("error streaming media", "media_id", media.ID, "error", err)
+	}
+}
+
+// 媒体文件的访问地址
+func mediaURL(mediaID int64) string {
+	return fmt.Sprintf("/v1/media/%d", mediaID)
+}
+
+// 填充原文件和各个版本的访问地址
+func setMediaURLs(m *store.Media) {
+	m.URL = mediaURL(m.ID)
+	if m.Status == store.MediaReady && m.ThumbnailKey != nil && m.MediumKey != nil {
+		m.ThumbnailURL = m.URL + "?variant=thumbnail"
+		m.MediumURL = m.URL + "?variant=medium"
+	}
+}
+
+// 给帖子填充附件
+func (app *application) attachPostMedia(ctx context.Context, posts []*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	media, err := app.store.Media.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byPost := map[int64][]store.Media{}
+	for _, m := range media {
+		setMediaURLs(&m)
+		byPost[*m.PostID] = append(byPost[*m.PostID], m)
+	}
+	for _, p := range posts {
+		p.Attachments = byPost[p.ID]
+		if p.Attachments == nil {
+			p.Attachments = []store.Media{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/looksaw/social/internal/blob"
+	"github.com/looksaw/social/internal/imaging"
+	"github.com/looksaw/social/internal/store"
+)
+
+const (
+	//单张图片的处理时间上限
+	mediaProcessTimeout = time.Minute * 2
+	//超过这个时间还没有处理完的重新入队
+	mediaStallAfter = time.Minute * 10
+	//每次从blob存储中删除的文件数
+	blobDeletionBatch = 100
+)
+
+// 把图片放入处理队列,队列满时留给requeueStalledMedia补偿
+func (app *application) enqueueMedia(mediaID int64) {
+	select {
+	case app.mediaQueue <- mediaID:
+	default:
+		app.logger.Warnw("media queue is full", "media_id", mediaID)
+	}
+}
+
+// 从队列中取出图片处理,直到ctx被取消
+func (app *application) runMediaWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mediaID := <-app.mediaQueue:
+			if err := app.processMedia(ctx, mediaID); err != nil {
+				app.logger.Errorw("error processing media", "media_id", mediaID, "error", err)
+			}
+		}
+	}
+}
+
+// 处理一张图片:去掉元数据重新编码,生成缩略图和中图,计算尺寸和blurhash
+func (app *application) processMedia(ctx context.Context, mediaID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, mediaProcessTimeout)
+	defer cancel()
+	media, err := app.store.Media.ClaimForProcessing(ctx, mediaID)
+	if err != nil {
+		//已经被别的worker处理了
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	data, err := app.readBlob(ctx, media.StorageKey, app.config.media.maxBytes)
+	if err != nil {
+		return err
+	}
+	res, err := imaging.Process(data, app.config.media.maxPixels)
+	if err != nil {
+		//图片本身的问题,重试也没有用
+		if err := app.store.Media.FailProcessing(ctx, media.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("processing image: %w", err)
+	}
+	thumbKey := media.StorageKey + "_thumb" + renditionExt(res.Thumbnail.MimeType)
+	mediumKey := media.StorageKey + "_medium" + renditionExt(res.Medium.MimeType)
+	if err := app.putRendition(ctx, thumbKey, &res.Thumbnail); err != nil {
+		return err
+	}
+	if err := app.putRendition(ctx, mediumKey, &res.Medium); err != nil {
+		return err
+	}
+	//用重新编码的版本覆盖原文件
+	if res.Original != nil {
+		if err := app.putRendition(ctx, media.StorageKey, res.Original); err != nil {
+			return err
+		}
+		media.MimeType = res.Original.MimeType
+		media.Size = int64(len(res.Original.Data))
+	}
+	media.Width = &res.Width
+	media.Height = &res.Height
+	media.Blurhash = &res.Blurhash
+	media.ThumbnailKey = &thumbKey
+	media.MediumKey = &mediumKey
+	err = app.store.Media.CompleteProcessing(ctx, media)
+	//处理过程中文件被删除了,刚写入的版本不会再有人删除
+	if errors.Is(err, store.ErrNotFound) {
+		app.deleteBlobs(ctx, []string{media.StorageKey, thumbKey, mediumKey})
+		return nil
+	}
+	return err
+}
+
+// 读取blob,最多读limit个字节
+func (app *application) readBlob(ctx context.Context, key string, limit int64) ([]byte, error) {
+	rc, err := app.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("blob %s is larger than %d bytes", key, limit)
+	}
+	return data, nil
+}
+
+func (app *application) putRendition(ctx context.Context, key string, r *imaging.Rendition) error {
+	return app.blobs.Put(ctx, key, bytes.NewReader(r.Data), int64(len(r.Data)), r.MimeType)
+}
+
+func renditionExt(mimeType string) string {
+	if mimeType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// 后台任务:删除一直没有使用的上传,再从blob存储中删除数据库里已经删除的文件
+func (app *application) cleanupMedia(ctx context.Context) error {
+	if err := app.store.Media.PurgeUnattached(ctx, time.Now().Add(-app.config.media.unattachedTTL)); err != nil {
+		return err
+	}
+	for {
+		keys, err := app.store.Media.GetBlobDeletions(ctx, blobDeletionBatch)
+		if err != nil {
+			return err
+		}
+		deleted := app.deleteBlobs(ctx, keys)
+		if len(deleted) > 0 {
+			if err := app.store.Media.RemoveBlobDeletions(ctx, deleted); err != nil {
+				return err
+			}
+		}
+		//有删除失败的留到下次
+		if len(keys) < blobDeletionBatch || len(deleted) < len(keys) {
+			return nil
+		}
+	}
+}
+
+// 从blob存储中删除文件,返回删除成功的,不存在的也算成功
+func (app *application) deleteBlobs(ctx context.Context, keys []string) []string {
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			app.logger.Errorw("error deleting blob", "key", key, "error", err)
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+	return deleted
+}
+
+// 把卡住的图片重新放回队列
+func (app *application) requeueStalledMedia(ctx context.Context) error {
+	ids, err := app.store.Media.RequeueStalled(ctx, time.Now().Add(-mediaStallAfter))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		app.enqueueMedia(id)
+	}
+	if len(ids) > 0 {
+		app.logger.Infow("requeued stalled media", "count", len(ids))
+	}
+	return nil
+}
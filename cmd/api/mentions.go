@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 得到提及当前用户的记录
+func (app *application) getUserMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	//默认的参数
+	fq := store.PaginationFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	mentions, err := app.store.Mentions.GetByUserID(r.Context(), user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, mentions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 给帖子及其评论填充提及
+func (app *application) attachMentions(ctx context.Context, post *store.Post) error {
+	mentions, err := app.store.Mentions.GetByPostIDs(ctx, []int64{post.ID})
+	if err != nil {
+		return err
+	}
+	post.Mentions = []store.Mention{}
+	byComment := map[int64][]store.Mention{}
+	for _, m := range mentions {
+		if m.CommentID == nil {
+			post.Mentions = append(post.Mentions, m)
+			continue
+		}
+		byComment[*m.CommentID] = append(byComment[*m.CommentID], m)
+	}
+	for i := range post.Comments {
+		post.Comments[i].Mentions = byComment[post.Comments[i].ID]
+		if post.Comments[i].Mentions == nil {
+			post.Comments[i].Mentions = []store.Mention{}
+		}
+	}
+	return nil
+}
+
+// 给feed中的帖子填充正文的提及
+func (app *application) attachFeedMentions(ctx context.Context, feed []store.PostWithMetadata) error {
+	if len(feed) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(feed))
+	for _, p := range feed {
+		ids = append(ids, p.ID)
+	}
+	mentions, err := app.store.Mentions.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byPost := map[int64][]store.Mention{}
+	for _, m := range mentions {
+		if m.CommentID == nil {
+			byPost[m.PostID] = append(byPost[m.PostID], m)
+		}
+	}
+	for i := range feed {
+		feed[i].Mentions = byPost[feed[i].ID]
+		if feed[i].Mentions == nil {
+			feed[i].Mentions = []store.Mention{}
+		}
+	}
+	return nil
+}
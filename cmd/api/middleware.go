@@ -72,6 +72,25 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
+// 只允许角色等级不低于requiredRole的用户访问
+func (app *application) requireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getUserFromContext(r)
+			role, err := app.store.Roles.GetByName(r.Context(), requiredRole)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if user.Role.Level < role.Level {
+				app.forbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // 检查权限
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
 	role, err := app.store.Roles.GetByName(ctx, roleName)
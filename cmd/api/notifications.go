@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 通知列表的返回
+type NotificationsResponse struct {
+	UnreadCount int                         `json:"unread_count"`
+	Groups      []NotificationGroupResponse `json:"groups"`
+}
+
+// 通知分组,附带一句可以直接展示的摘要
+type NotificationGroupResponse struct {
+	store.NotificationGroup
+	Summary string `json:"summary"`
+}
+
+// 得到当前用户的通知,按组分页,下一页的地址通过Link头返回
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	qs := r.URL.Query()
+	limit := 20
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 50 {
+			app.badRequestResponse(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = l
+	}
+	var before int64
+	if v := qs.Get("cursor"); v != "" {
+		c, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || c <= 0 {
+			app.badRequestResponse(w, r, store.ErrInvalidCursor)
+			return
+		}
+		before = c
+	}
+	ctx := r.Context()
+	groups, err := app.store.Notifications.GetGroups(ctx, user.ID, before, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	unread, err := app.store.Notifications.UnreadCount(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	resp := NotificationsResponse{
+		UnreadCount: unread,
+		Groups:      make([]NotificationGroupResponse, 0, len(groups)),
+	}
+	for _, g := range groups {
+		resp.Groups = append(resp.Groups, NotificationGroupResponse{
+			NotificationGroup: g,
+			Summary:           notificationSummary(g),
+		})
+	}
+	if len(groups) == limit {
+		w.Header().Set("Link", nextPageLink(r, strconv.FormatInt(groups[len(groups)-1].ID, 10)))
+	}
+	if err := app.jsonResponse(w, http.StatusOK, resp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 标记已读的请求,ids为空时标记全部
+type MarkNotificationsReadPayload struct {
+	IDs []int64 `json:"ids" validate:"max=500,dive,gt=0"`
+}
+
+// 标记通知为已读
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MarkNotificationsReadPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, payload.IDs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 例如 "alice and 4 others commented on your post"
+func notificationSummary(g store.NotificationGroup) string {
+	var verb string
+	switch g.Type {
+	case store.NotificationFollow:
+		verb = "followed you"
+	case store.NotificationComment:
+		verb = "commented on your post"
+	case store.NotificationMention:
+		verb = "mentioned you"
+	default:
+		verb = g.Type
+	}
+	if len(g.Actors) == 0 {
+		return verb
+	}
+	switch g.ActorCount {
+	case 1:
+		return fmt.Sprintf("%s %s", g.Actors[0].Username, verb)
+	case 2:
+		if len(g.Actors) > 1 {
+			return fmt.Sprintf("%s and %s %s", g.Actors[0].Username, g.Actors[1].Username, verb)
+		}
+	}
+	others := g.ActorCount - 1
+	if others == 1 {
+		return fmt.Sprintf("%s and 1 other %s", g.Actors[0].Username, verb)
+	}
+	return fmt.Sprintf("%s and %d others %s", g.Actors[0].Username, others, verb)
+}
+
+// 写入通知,推送给在线的接收者,并按邮件偏好发送邮件
+// 重复的关注和提及通知不会重复写入,事件重试时可以安全调用
+func (app *application) notify(ctx context.Context, notifications ...store.Notification) error {
+	created, err := app.store.Notifications.Create(ctx, notifications)
+	if err != nil {
+		return err
+	}
+	for _, n := range created {
+		app.publish(ctx, userTopic(n.UserID), eventNotificationCreated, n)
+	}
+	//邮件进入发送队列,入队失败不影响通知本身
+	if len(created) > 0 {
+		app.queueNotificationEmails(ctx, created)
+	}
+	return nil
+}
+
+// 通知被提及的用户,skip中的用户不再通知
+func (app *application) notifyMentions(ctx context.Context, actorID int64, mentions []store.Mention, skip ...int64) error {
+	notifications := make([]store.Notification, 0, len(mentions))
+	for _, m := range mentions {
+		skipped := false
+		for _, id := range skip {
+			skipped = skipped || m.UserID == id
+		}
+		if skipped {
+			continue
+		}
+		postID := m.PostID
+		notifications = append(notifications, store.Notification{
+			UserID:    m.UserID,
+			ActorID:   actorID,
+			Type:      store.NotificationMention,
+			PostID:    &postID,
+			CommentID: m.CommentID,
+		})
+	}
+	return app.notify(ctx, notifications...)
+}
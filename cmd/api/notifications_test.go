@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+func TestNotificationSummary(t *testing.T) {
+	alice := store.Actor{ID: 1, Username: "alice"}
+	bob := store.Actor{ID: 2, Username: "bob"}
+	tests := []struct {
+		name  string
+		group store.NotificationGroup
+		want  string
+	}{
+		{"one actor", store.NotificationGroup{Type: store.NotificationFollow, ActorCount: 1, Actors: []store.Actor{alice}}, "alice followed you"},
+		{"two actors", store.NotificationGroup{Type: store.NotificationComment, ActorCount: 2, Actors: []store.Actor{alice, bob}}, "alice and bob commented on your post"},
+		{"three actors", store.NotificationGroup{Type: store.NotificationMention, ActorCount: 3, Actors: []store.Actor{alice, bob}}, "alice and 2 others mentioned you"},
+		{"many actors", store.NotificationGroup{Type: store.NotificationFollow, ActorCount: 10, Actors: []store.Actor{alice, bob}}, "alice and 9 others followed you"},
+		//第二个人已经删除,只剩下一个
+		{"two actors, one loaded", store.NotificationGroup{Type: store.NotificationFollow, ActorCount: 2, Actors: []store.Actor{alice}}, "alice and 1 other followed you"},
+		{"no actors", store.NotificationGroup{Type: store.NotificationFollow, ActorCount: 0}, "followed you"},
+		{"unknown type", store.NotificationGroup{Type: "liked", ActorCount: 1, Actors: []store.Actor{alice}}, "alice liked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notificationSummary(tt.group); got != tt.want {
+				t.Errorf("notificationSummary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
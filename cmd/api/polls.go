@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 投票最长持续的时间
+const maxPollDuration = time.Hour * 24 * 30
+
+// 创建帖子时附带的投票
+type CreatePollPayload struct {
+	Options   []string  `json:"options" validate:"min=2,max=6,dive,required,max=100"`
+	Multiple  bool      `json:"multiple"`
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+// 检查并转换成store的投票
+func (p *CreatePollPayload) toPoll(now time.Time) (*store.Poll, error) {
+	if !p.ExpiresAt.After(now) {
+		return nil, errors.New("poll expires_at must be in the future")
+	}
+	if p.ExpiresAt.After(now.Add(maxPollDuration)) {
+		return nil, fmt.Errorf("poll can last at most %s", maxPollDuration)
+	}
+	poll := &store.Poll{
+		Multiple:  p.Multiple,
+		ExpiresAt: p.ExpiresAt,
+		Options:   make([]store.PollOption, 0, len(p.Options)),
+	}
+	seen := map[string]bool{}
+	for _, text := range p.Options {
+		text = strings.TrimSpace(text)
+		key := strings.ToLower(text)
+		if text == "" || seen[key] {
+			return nil, errors.New("poll options must be unique and not empty")
+		}
+		seen[key] = true
+		poll.Options = append(poll.Options, store.PollOption{Text: text})
+	}
+	return poll, nil
+}
+
+// 投票的请求
+type VotePayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"required,min=1,max=6,dive,gt=0"`
+}
+
+// 对帖子上的投票投票,返回投票之后的结果
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	var payload VotePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	//还没有发布的帖子不能投票
+	if post.Status != store.PostStatusPublished {
+		app.conflictResponse(w, r, errors.New("post is not published"))
+		return
+	}
+	ctx := r.Context()
+	if err := app.store.Polls.Vote(ctx, post.ID, user.ID, payload.OptionIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		case errors.Is(err, store.ErrPollClosed), errors.Is(err, store.ErrAlreadyVoted):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrInvalidVote):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.attachPolls(ctx, []*store.Post{post}, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, post.Poll); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 给帖子填充投票,结果是否可见取决于viewerID
+func (app *application) attachPolls(ctx context.Context, posts []*store.Post, viewerID int64) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	polls, err := app.store.Polls.GetByPostIDs(ctx, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	byPost := make(map[int64]*store.Poll, len(polls))
+	for i := range polls {
+		byPost[polls[i].PostID] = &polls[i]
+	}
+	for _, p := range posts {
+		p.Poll = byPost[p.ID]
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/looksaw/social/internal/store"
@@ -17,9 +18,16 @@ var postCtx postKey = "post"
 
 // 发送CreatePost的2请求结构体
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title string `json:"title" validate:"required,max=100"`
+	//Markdown源文,validator对字符串的max按rune计数
+	Content    string     `json:"content" validate:"required,max=1000"`
+	Tags       []string   `json:"tags"`
+	Status     string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"`
+	Visibility string     `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
+	//之前通过POST /v1/media上传的文件
+	AttachmentIDs []int64            `json:"attachment_ids" validate:"max=4,dive,gt=0"`
+	Poll          *CreatePollPayload `json:"poll"`
 }
 
 // 处理createPost的请求
@@ -35,21 +43,71 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	//规范化标签并合并正文中的hashtag
+	explicit, err := store.NormalizeTags(payload.Tags, "")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	tags, err := store.NormalizeTags(explicit, payload.Content)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	//没有指定状态时,有发布时间就是定时发布,否则直接发布
+	status := payload.Status
+	if status == "" {
+		status = store.PostStatusPublished
+		if payload.PublishAt != nil {
+			status = store.PostStatusScheduled
+		}
+	}
+	if err := validatePublishState(status, payload.PublishAt); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var poll *store.Poll
+	if payload.Poll != nil {
+		poll, err = payload.Poll.toPoll(time.Now())
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
 	user := getUserFromContext(r)
 	post := &store.Post{
-		UserID:  user.ID,
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
+		UserID:        user.ID,
+		Title:         payload.Title,
+		Content:       payload.Content,
+		Tags:          tags,
+		ExplicitTags:  explicit,
+		Status:        status,
+		PublishAt:     payload.PublishAt,
+		Visibility:    payload.Visibility,
+		AttachmentIDs: payload.AttachmentIDs,
+		Poll:          poll,
 	}
 	//得到对应的context
 	ctx := r.Context()
 	//写入Post
 	if err := app.store.Posts.Create(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrInvalidAttachment):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
+	for i := range post.Attachments {
+		setMediaURLs(&post.Attachments[i])
+	}
+	if post.Status == store.PostStatusPublished {
+		app.afterPostPublished(ctx, post)
+	}
+	w.Header().Set("ETag", postETag(post))
 	//返回写入Post
+	renderPost(post)
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -86,6 +144,31 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	post.Comments = comments
+	//得到提及
+	if err := app.attachMentions(ctx, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//得到附件
+	if err := app.attachPostMedia(ctx, []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//得到投票
+	if err := app.attachPolls(ctx, []*store.Post{post}, getUserFromContext(r).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	renderPost(post)
+	//条件GET,投票和附件的变化没有对应的更新时间,只使用ETag
+	etag, err := postRepresentationETag(post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, etag, time.Time{}) {
+		return
+	}
 	//写入post
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -105,28 +188,45 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	ctx := r.Context()
-
-	if err := app.store.Posts.Delete(ctx, id); err != nil {
+	user := getUserFromContext(r)
+	if err := app.store.Posts.Delete(ctx, id, user.ID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFound(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
 	}
+	app.publish(ctx, postTopic(id), eventPostDeleted, map[string]any{"id": id})
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Update的模型
 type UpdatePayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title   *string   `json:"title" validate:"omitempty,max=100"`
+	Content *string   `json:"content" validate:"omitempty,max=1000"`
+	Tags    *[]string `json:"tags"`
+	//草稿和定时发布
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
+	//可见范围
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
 }
 
 // Update操作
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	//从Context中得到post
 	post := getPostFromCtx(r)
+	//乐观锁:必须带上If-Match,并且和当前的版本一致
+	if r.Header.Get("If-Match") == "" {
+		app.preconditionRequiredResponse(w, r, errors.New("If-Match header is required"))
+		return
+	}
+	if !ifMatch(r, post) {
+		app.preconditionFailedResponse(w, r, store.ErrEditConflict)
+		return
+	}
 
 	//解析UpdatePayload
 	var payload UpdatePayload
@@ -147,14 +247,71 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
+	//标签或者正文变化时,由显式的标签和现在的正文重新生成标签
+	//只修改正文时沿用保存的显式标签,以前保存的不合法标签直接丢弃
+	if payload.Tags != nil || payload.Content != nil {
+		explicit := store.ValidTags(post.ExplicitTags)
+		if payload.Tags != nil {
+			var err error
+			explicit, err = store.NormalizeTags(*payload.Tags, "")
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+		}
+		tags, err := store.NormalizeTags(explicit, post.Content)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		post.ExplicitTags = explicit
+		post.Tags = tags
+	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+	//修改发布状态
+	wasPublished := post.Status == store.PostStatusPublished
+	if payload.Status != nil || payload.PublishAt != nil {
+		if wasPublished {
+			app.badRequestResponse(w, r, errors.New("published posts cannot change status or publish_at"))
+			return
+		}
+		if payload.Status != nil {
+			post.Status = *payload.Status
+			if post.Status != store.PostStatusScheduled {
+				post.PublishAt = nil
+			}
+		}
+		if payload.PublishAt != nil {
+			post.PublishAt = payload.PublishAt
+		}
+		if err := validatePublishState(post.Status, post.PublishAt); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
 
 	ctx := r.Context()
 	//数据库执行Patch
-	if err := app.store.Posts.Update(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.store.Posts.Update(ctx, post, getUserFromContext(r).ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
-
+	if post.Status == store.PostStatusPublished && !wasPublished {
+		app.afterPostPublished(ctx, post)
+	}
+	app.publish(ctx, postTopic(post.ID), eventPostUpdated, map[string]any{
+		"id":      post.ID,
+		"version": post.Version,
+	})
+	w.Header().Set("ETag", postETag(post))
+	renderPost(post)
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -185,14 +342,101 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 				return
 			}
 		}
+		//看不到的帖子当作不存在
+		canView, err := app.canViewPost(ctx, post, getUserFromContext(r))
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !canView {
+			app.notFound(w, r, store.ErrNotFound)
+			return
+		}
 		//将Post存入ctx
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// 草稿和定时发布的帖子只有作者能看到,已发布的按可见范围判断
+// 版主以上可以看到所有已发布的帖子,否则无法编辑,删除和恢复修订
+func (app *application) canViewPost(ctx context.Context, post *store.Post, viewer *store.User) (bool, error) {
+	if post.Status != store.PostStatusPublished {
+		return post.UserID == viewer.ID, nil
+	}
+	ok, err := app.store.Posts.CanView(ctx, post.ID, viewer.ID)
+	if err != nil || ok {
+		return ok, err
+	}
+	role, err := app.store.Roles.GetByName(ctx, "moderator")
+	if err != nil {
+		return false, err
+	}
+	return viewer.Role.Level >= role.Level, nil
+}
+
 // 从r的上下文中间的到post
 func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
 }
+
+// 检查发布状态和发布时间是否匹配
+func validatePublishState(status string, publishAt *time.Time) error {
+	if status == store.PostStatusScheduled {
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return errors.New("scheduled posts need a publish_at in the future")
+		}
+		return nil
+	}
+	if publishAt != nil {
+		return errors.New("publish_at is only allowed for scheduled posts")
+	}
+	return nil
+}
+
+// 帖子发布之后的实时推送,直接发布和定时发布都会调用
+// 通知和webhook由PostCreated事件的handler处理
+func (app *application) afterPostPublished(ctx context.Context, post *store.Post) {
+	app.logger.Infow("post published", "post_id", post.ID, "user_id", post.UserID)
+	//推送给关注者,只对关注者可见以内的帖子推送
+	if post.Visibility == store.VisibilityPublic || post.Visibility == store.VisibilityFollowers {
+		app.publish(ctx, authorTopic(post.UserID), eventPostPublished, map[string]any{
+			"id":         post.ID,
+			"user_id":    post.UserID,
+			"title":      post.Title,
+			"visibility": post.Visibility,
+			"created_at": post.CreatedAt,
+		})
+	}
+}
+
+// 得到当前用户的草稿和定时发布的帖子
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for i := range drafts {
+		renderPost(&drafts[i])
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 后台任务:发布到时间的定时帖子
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	posts, err := app.store.Posts.PublishDue(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		app.afterPostPublished(ctx, &posts[i])
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+func TestValidatePublishState(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		status    string
+		publishAt *time.Time
+		wantErr   bool
+	}{
+		{"published", store.PostStatusPublished, nil, false},
+		{"draft", store.PostStatusDraft, nil, false},
+		{"scheduled in the future", store.PostStatusScheduled, &future, false},
+		{"scheduled without time", store.PostStatusScheduled, nil, true},
+		{"scheduled in the past", store.PostStatusScheduled, &past, true},
+		{"published with time", store.PostStatusPublished, &future, true},
+		{"draft with time", store.PostStatusDraft, &future, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePublishState(tt.status, tt.publishAt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePublishState(%q) = %v, wantErr %v", tt.status, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 可见范围由CanView决定的帖子存储
+type fakeVisibilityPosts struct {
+	*store.PostStore
+	canView bool
+}
+
+func (f *fakeVisibilityPosts) CanView(ctx context.Context, postID int64, viewerID int64) (bool, error) {
+	return f.canView, nil
+}
+
+type fakeRoles struct{}
+
+func (fakeRoles) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	levels := map[string]int{"user": 1, "moderator": 2, "admin": 3}
+	return &store.Role{Name: name, Level: levels[name]}, nil
+}
+
+func TestCanViewPost(t *testing.T) {
+	const authorID, otherID = 1, 2
+	user := store.Role{Name: "user", Level: 1}
+	moderator := store.Role{Name: "moderator", Level: 2}
+	admin := store.Role{Name: "admin", Level: 3}
+	tests := []struct {
+		name     string
+		status   string
+		viewerID int64
+		role     store.Role
+		canView  bool
+		want     bool
+	}{
+		{"draft by author", store.PostStatusDraft, authorID, user, false, true},
+		{"draft by other", store.PostStatusDraft, otherID, user, true, false},
+		{"draft by moderator", store.PostStatusDraft, otherID, moderator, true, false},
+		{"scheduled by other", store.PostStatusScheduled, otherID, admin, true, false},
+		{"in audience", store.PostStatusPublished, otherID, user, true, true},
+		{"outside audience", store.PostStatusPublished, otherID, user, false, false},
+		{"moderator outside audience", store.PostStatusPublished, otherID, moderator, false, true},
+		{"admin outside audience", store.PostStatusPublished, otherID, admin, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(&store.Storage{
+				Posts: &fakeVisibilityPosts{canView: tt.canView},
+				Roles: fakeRoles{},
+			})
+			post := &store.Post{ID: 10, UserID: authorID, Status: tt.status}
+			viewer := &store.User{ID: tt.viewerID, Role: tt.role}
+			got, err := app.canViewPost(context.Background(), post, viewer)
+			if err != nil {
+				t.Fatalf("canViewPost: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("canViewPost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
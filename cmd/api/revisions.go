@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/diff"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 修订记录以及这次编辑的变化
+type RevisionWithDiff struct {
+	store.Revision
+	TitleDiff   []diff.Line `json:"title_diff"`
+	ContentDiff []diff.Line `json:"content_diff"`
+}
+
+// 得到帖子的修订记录,每条记录附带和下一个版本的diff
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	revisions, err := app.store.Revisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	result := make([]RevisionWithDiff, 0, len(revisions))
+	for i, rev := range revisions {
+		//下一个版本是下一条修订记录,最后一条的下一个版本是当前的帖子
+		nextTitle, nextContent := post.Title, post.Content
+		if i+1 < len(revisions) {
+			nextTitle, nextContent = revisions[i+1].Title, revisions[i+1].Content
+		}
+		result = append(result, RevisionWithDiff{
+			Revision:    rev,
+			TitleDiff:   diff.Lines(rev.Title, nextTitle),
+			ContentDiff: diff.Lines(rev.Content, nextContent),
+		})
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 把帖子恢复到某条修订记录的内容,恢复本身也会产生一条新的修订记录
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	revisionID, err := strconv.ParseInt(chi.URLParam(r, "revisionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	rev, err := app.store.Revisions.GetByID(ctx, post.ID, revisionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	post.Title = rev.Title
+	post.Content = rev.Content
+	post.Tags = rev.Tags
+	if err := app.store.Posts.Update(ctx, post, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.Header().Set("ETag", postETag(post))
+	renderPost(post)
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looksaw/social/internal/pubsub"
+	"github.com/looksaw/social/internal/store"
+)
+
+const (
+	//心跳间隔,防止代理断开空闲连接
+	streamHeartbeat = time.Second * 25
+	//一个连接最多关注的帖子
+	maxStreamPosts = 20
+)
+
+// 事件的类型
+const (
+	eventPostPublished       = "post.published"
+	eventNotificationCreated = "notification.created"
+	eventCommentCreated      = "comment.created"
+	eventCommentDeleted      = "comment.deleted"
+	eventPostUpdated         = "post.updated"
+	eventPostDeleted         = "post.deleted"
+)
+
+// 用户自己的事件,比如通知
+func userTopic(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// 作者发布的新帖子,关注者订阅
+func authorTopic(userID int64) string {
+	return fmt.Sprintf("author:%d", userID)
+}
+
+// 帖子下的评论
+func postTopic(postID int64) string {
+	return fmt.Sprintf("post:%d", postID)
+}
+
+// 发布事件,失败只记录日志
+func (app *application) publish(ctx context.Context, topic string, typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		app.logger.Errorw("error encoding event", "topic", topic, "type", typ, "error", err)
+		return
+	}
+	ev := pubsub.Event{Topic: topic, Type: typ, Data: raw}
+	if err := app.events.Publish(ctx, ev); err != nil {
+		app.logger.Errorw("error publishing event", "topic", topic, "type", typ, "error", err)
+	}
+}
+
+// SSE推送:自己的通知,关注的人的新帖子,以及posts参数中帖子的评论
+// 关注关系在连接时确定,变化之后需要重新连接
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	topics := []string{userTopic(user.ID), authorTopic(user.ID)}
+	//要关注评论的帖子
+	if v := r.URL.Query().Get("posts"); v != "" {
+		ids := strings.Split(v, ",")
+		if len(ids) > maxStreamPosts {
+			app.badRequestResponse(w, r, fmt.Errorf("at most %d posts can be streamed", maxStreamPosts))
+			return
+		}
+		for _, s := range ids {
+			postID, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+			post, err := app.store.Posts.GetByID(ctx, postID)
+			if err != nil {
+				switch {
+				case errors.Is(err, store.ErrNotFound):
+					app.notFound(w, r, err)
+				default:
+					app.internalServerError(w, r, err)
+				}
+				return
+			}
+			ok, err := app.canViewPost(ctx, post, user)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !ok {
+				app.notFound(w, r, store.ErrNotFound)
+				return
+			}
+			topics = append(topics, postTopic(postID))
+		}
+	}
+	following, err := app.store.Followers.FollowingIDs(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, id := range following {
+		topics = append(topics, authorTopic(id))
+	}
+	//长连接不受服务器写超时的限制
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	sub := app.hub.Subscribe(topics...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-sub.Events():
+			//消费太慢被关闭了,客户端重连之后重新拉取
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 标签自动补全
+func (app *application) searchTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	prefix, err := store.NormalizeTag(qs.Get("prefix"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	//默认返回10个
+	limit := 10
+	if l := qs.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 50 {
+			app.badRequestResponse(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = parsed
+	}
+	tags, err := app.store.Tags.Search(r.Context(), prefix, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 作者主页的帖子,置顶的排在最前面,支持和feed一样的分页和过滤参数
+// 也支持cursor分页,下一页的地址通过Link头返回
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	fq := store.PaginationFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if fq.Cursor != "" && fq.Offset != 0 {
+		app.badRequestResponse(w, r, errors.New("offset cannot be combined with cursor"))
+		return
+	}
+	ctx := r.Context()
+	if _, err := app.store.Users.GetByID(ctx, authorID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	viewer := getUserFromContext(r)
+	posts, next, err := app.store.Posts.GetUserPosts(ctx, authorID, viewer.ID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if next != "" {
+		w.Header().Set("Link", nextPageLink(r, next))
+	}
+	if err := app.attachFeedExtras(ctx, posts, viewer.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, posts)
+}
+
+// 下一页的Link头,保留其他查询参数
+func nextPageLink(r *http.Request, cursor string) string {
+	u := *r.URL
+	qs := u.Query()
+	qs.Del("offset")
+	qs.Set("cursor", cursor)
+	u.RawQuery = qs.Encode()
+	return fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI())
+}
+
+// 置顶自己的帖子
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	if err := app.store.Posts.Pin(r.Context(), post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		case errors.Is(err, store.ErrPinLimit):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 取消置顶
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	if err := app.store.Posts.Unpin(r.Context(), post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
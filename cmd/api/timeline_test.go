@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 只实现置顶的帖子存储
+type fakePinPosts struct {
+	*store.PostStore
+	err    error
+	called bool
+}
+
+func (f *fakePinPosts) Pin(ctx context.Context, postID int64, userID int64) error {
+	f.called = true
+	return f.err
+}
+
+func (f *fakePinPosts) Unpin(ctx context.Context, postID int64, userID int64) error {
+	f.called = true
+	return f.err
+}
+
+// 和postContextMiddleware一样把帖子放进上下文
+func withPost(post *store.Post, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), postCtx, post)))
+	}
+}
+
+func TestPinHandlers(t *testing.T) {
+	post := &store.Post{ID: 3, UserID: 1}
+	tests := []struct {
+		name   string
+		userID int64
+		err    error
+		pin    int
+		unpin  int
+		stored bool
+	}{
+		{"author", 1, nil, http.StatusNoContent, http.StatusNoContent, true},
+		{"not the author", 2, nil, http.StatusForbidden, http.StatusForbidden, false},
+		{"not pinnable", 1, store.ErrNotFound, http.StatusNotFound, http.StatusNotFound, true},
+		{"pin limit", 1, store.ErrPinLimit, http.StatusConflict, http.StatusInternalServerError, true},
+		{"store error", 1, errors.New("boom"), http.StatusInternalServerError, http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		user := &store.User{ID: tt.userID}
+		for _, h := range []struct {
+			method  string
+			handler func(*application, http.ResponseWriter, *http.Request)
+			status  int
+		}{
+			{http.MethodPut, (*application).pinPostHandler, tt.pin},
+			{http.MethodDelete, (*application).unpinPostHandler, tt.unpin},
+		} {
+			t.Run(h.method+"/"+tt.name, func(t *testing.T) {
+				posts := &fakePinPosts{err: tt.err}
+				app := newTestApplication(&store.Storage{Posts: posts})
+				rr := serve(t, user, h.method, "/pin", "/pin", withPost(post, func(w http.ResponseWriter, r *http.Request) {
+					h.handler(app, w, r)
+				}))
+				if rr.Code != h.status {
+					t.Errorf("status = %d, want %d", rr.Code, h.status)
+				}
+				if posts.called != tt.stored {
+					t.Errorf("store called = %v, want %v", posts.called, tt.stored)
+				}
+			})
+		}
+	}
+}
+
+func TestNextPageLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/v1/users/1/posts", `</v1/users/1/posts?cursor=abc>; rel="next"`},
+		{"/v1/users/1/posts?limit=5&tags=go", `</v1/users/1/posts?cursor=abc&limit=5&tags=go>; rel="next"`},
+		{"/v1/users/1/posts?offset=20&cursor=old", `</v1/users/1/posts?cursor=abc>; rel="next"`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if got := nextPageLink(r, "abc"); got != tt.want {
+			t.Errorf("nextPageLink(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
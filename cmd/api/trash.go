@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/store"
+)
+
+// 得到当前用户回收站中的内容
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	trash, err := app.store.Trash.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for i := range trash.Posts {
+		renderPost(&trash.Posts[i].Post)
+	}
+	for i := range trash.Comments {
+		renderComment(&trash.Comments[i].Comment)
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, trash); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 从回收站恢复帖子
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := app.store.Trash.RestorePost(r.Context(), user.ID, postID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 从回收站恢复评论
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := app.store.Trash.RestoreComment(r.Context(), user.ID, commentID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 后台任务:彻底删除超过保留期的内容
+func (app *application) purgeTrash(ctx context.Context) error {
+	return app.store.Trash.Purge(ctx, time.Now().Add(-app.config.trash.retention))
+}
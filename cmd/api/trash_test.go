@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 只实现恢复的回收站,记录调用的参数
+type fakeTrash struct {
+	*store.TrashStore
+	err    error
+	userID int64
+	id     int64
+}
+
+func (f *fakeTrash) RestorePost(ctx context.Context, userID int64, postID int64) error {
+	f.userID, f.id = userID, postID
+	return f.err
+}
+
+func (f *fakeTrash) RestoreComment(ctx context.Context, userID int64, commentID int64) error {
+	f.userID, f.id = userID, commentID
+	return f.err
+}
+
+func TestRestoreHandlers(t *testing.T) {
+	user := &store.User{ID: 5}
+	tests := []struct {
+		name   string
+		path   string
+		err    error
+		status int
+	}{
+		{"restored", "/42", nil, http.StatusNoContent},
+		{"not in the user's trash", "/42", store.ErrNotFound, http.StatusNotFound},
+		{"store error", "/42", errors.New("boom"), http.StatusInternalServerError},
+		{"invalid id", "/abc", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		for _, h := range []struct {
+			param   string
+			handler func(*application, http.ResponseWriter, *http.Request)
+		}{
+			{"postID", (*application).restorePostHandler},
+			{"commentID", (*application).restoreCommentHandler},
+		} {
+			t.Run(h.param+"/"+tt.name, func(t *testing.T) {
+				trash := &fakeTrash{err: tt.err}
+				app := newTestApplication(&store.Storage{Trash: trash})
+				rr := serve(t, user, http.MethodPost, "/{"+h.param+"}", tt.path, func(w http.ResponseWriter, r *http.Request) {
+					h.handler(app, w, r)
+				})
+				if rr.Code != tt.status {
+					t.Fatalf("status = %d, want %d", rr.Code, tt.status)
+				}
+				//只能恢复自己回收站中的内容,存储层按当前用户过滤
+				if tt.status != http.StatusBadRequest && (trash.userID != user.ID || trash.id != 42) {
+					t.Errorf("restored %d for user %d, want 42 for user %d", trash.id, trash.userID, user.ID)
+				}
+			})
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/looksaw/social/internal/store"
@@ -36,6 +37,15 @@ type FollwerUser struct {
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	//利用中间件的信息
 	user := getUserFromContext(r)
+	//条件GET
+	etag, err := weakETag(user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, etag, parseTimestamp(user.UpdatedAt)) {
+		return
+	}
 	//返回结果
 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
@@ -98,6 +108,31 @@ func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// 推荐关注的用户
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	//默认返回10个
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 50 {
+			app.badRequestResponse(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = parsed
+	}
+	suggestions, err := app.store.Followers.Suggestions(r.Context(), user.ID, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 // 得到UserID的中间件
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -159,3 +194,76 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 }
+
+// 申请删除当前用户,宽限期内重新登陆即可取消
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	deleteAt := time.Now().Add(app.config.deletion.grace)
+	if err := app.store.Users.ScheduleDeletion(r.Context(), user.ID, deleteAt); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	data := map[string]string{
+		"deletion_scheduled_at": deleteAt.Format(time.RFC3339),
+	}
+	//回写
+	if err := app.jsonResponse(w, http.StatusAccepted, data); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 用户设置的请求,字段为空表示不修改
+type UpdateSettingsPayload struct {
+	DMPolicy *string `json:"dm_policy" validate:"omitempty,oneof=everyone following"`
+}
+
+// 修改当前用户的设置
+func (app *application) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateSettingsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromContext(r)
+	if payload.DMPolicy != nil {
+		if err := app.store.Users.SetDMPolicy(r.Context(), user.ID, *payload.DMPolicy); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		user.DMPolicy = *payload.DMPolicy
+	}
+	data := map[string]string{
+		"dm_policy": user.DMPolicy,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 后台任务:彻底删除宽限期已过的用户
+func (app *application) purgeDeletedUsers(ctx context.Context) error {
+	ids, err := app.store.Users.GetDueDeletions(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	policy := store.DeletionPolicy(app.config.deletion.policy)
+	for _, id := range ids {
+		if err := app.store.Users.Purge(ctx, id, policy); err != nil {
+			app.logger.Errorw("error purging user", "user_id", id, "error", err)
+			continue
+		}
+		app.logger.Infow("user purged", "user_id", id, "policy", policy)
+	}
+	return nil
+}
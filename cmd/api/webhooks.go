@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/looksaw/social/internal/store"
+	"github.com/looksaw/social/internal/webhook"
+)
+
+// 创建webhook订阅的请求,secret为空时自动生成
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=255"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=post.created user.followed comment.created"`
+	Active *bool    `json:"active"`
+}
+
+// 修改webhook订阅的请求,字段为空表示不修改
+type UpdateWebhookPayload struct {
+	URL    *string  `json:"url" validate:"omitempty,http_url,max=2048"`
+	Events []string `json:"events" validate:"omitempty,min=1,dive,oneof=post.created user.followed comment.created"`
+	Active *bool    `json:"active"`
+}
+
+// 创建时返回签名密钥,之后不再返回
+type WebhookWithSecret struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+// 投递给外部系统的内容
+type webhookEnvelope struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// 创建webhook订阅
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	secret := payload.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		secret = hex.EncodeToString(b)
+	}
+	user := getUserFromContext(r)
+	hook := &store.Webhook{
+		URL:       payload.URL,
+		Secret:    secret,
+		Events:    payload.Events,
+		Active:    payload.Active == nil || *payload.Active,
+		CreatedBy: &user.ID,
+	}
+	if err := app.store.Webhooks.Create(r.Context(), hook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, WebhookWithSecret{Webhook: *hook, Secret: secret}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 所有的webhook订阅
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks, err := app.store.Webhooks.GetAll(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, hooks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 得到webhook订阅
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, hook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 修改webhook订阅
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var payload UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if payload.URL != nil {
+		hook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		hook.Events = payload.Events
+	}
+	if payload.Active != nil {
+		hook.Active = *payload.Active
+	}
+	if err := app.store.Webhooks.Update(r.Context(), hook); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, hook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 删除webhook订阅
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := app.store.Webhooks.Delete(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 投递日志,按时间倒序,下一页的地址通过Link头返回
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, err := parseLimit(r, 20, 100)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var before int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || before <= 0 {
+			app.badRequestResponse(w, r, store.ErrInvalidCursor)
+			return
+		}
+	}
+	deliveries, err := app.store.Webhooks.GetDeliveries(r.Context(), hook.ID, before, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if len(deliveries) == limit {
+		w.Header().Set("Link", nextPageLink(r, strconv.FormatInt(deliveries[len(deliveries)-1].ID, 10)))
+	}
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 重新投递一次,会创建一个新的投递
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.webhookFromRequest(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	delivery, err := app.store.Webhooks.Redeliver(r.Context(), hook.ID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, delivery); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// 根据URL中的webhookID得到订阅,失败时已经写好了响应
+func (app *application) webhookFromRequest(w http.ResponseWriter, r *http.Request) (*store.Webhook, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	hook, err := app.store.Webhooks.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	return hook, true
+}
+
+// 给订阅了event的webhook创建投递
+func (app *application) enqueueWebhook(ctx context.Context, event string, data any) error {
+	body, err := json.Marshal(webhookEnvelope{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	return app.store.Webhooks.Enqueue(ctx, event, body)
+}
+
+// 后台任务:投递到期的webhook,直到没有到期的投递
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	//领取之后在超时之前没有记录结果的投递会被重新领取
+	lease := app.config.webhook.timeout + time.Minute
+	for {
+		deliveries, err := app.store.Webhooks.ClaimDue(ctx, lease, app.config.webhook.batchSize)
+		if err != nil {
+			return err
+		}
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(d *store.WebhookDelivery) {
+				defer wg.Done()
+				app.deliverWebhook(ctx, d)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+		if len(deliveries) < app.config.webhook.batchSize {
+			return nil
+		}
+	}
+}
+
+// 投递一次并记录结果,失败时按指数退避安排下一次重试
+func (app *application) deliverWebhook(ctx context.Context, d *store.WebhookDelivery) {
+	result, err := app.webhooks.Deliver(ctx, d.URL, d.Secret, d.Event, d.ID, d.Payload)
+	attempt := d.Attempts + 1
+	d.Status = store.DeliverySucceeded
+	d.NextAttemptAt = time.Now()
+	d.LastStatusCode = nil
+	if result.StatusCode != 0 {
+		d.LastStatusCode = &result.StatusCode
+	}
+	d.LastResponse = &result.Response
+	d.LastError = nil
+	if err != nil {
+		msg := err.Error()
+		d.LastError = &msg
+		if attempt >= webhook.MaxAttempts {
+			d.Status = store.DeliveryFailed
+		} else {
+			d.Status = store.DeliveryPending
+			d.NextAttemptAt = time.Now().Add(webhook.Backoff(attempt))
+		}
+		app.logger.Warnw("webhook delivery failed", "delivery_id", d.ID, "webhook_id", d.WebhookID, "attempt", attempt, "error", err)
+	}
+	if err := app.store.Webhooks.RecordAttempt(ctx, d); err != nil {
+		app.logger.Errorw("error recording webhook delivery", "delivery_id", d.ID, "error", err)
+	}
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE
+    users
+DROP
+    COLUMN deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN deletion_scheduled_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
\ No newline at end of file
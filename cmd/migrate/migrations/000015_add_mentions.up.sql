@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    author_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments(id) ON DELETE CASCADE,
+    start_offset int NOT NULL,
+    end_offset int NOT NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions(post_id);
\ No newline at end of file
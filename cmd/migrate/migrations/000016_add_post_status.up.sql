@@ -0,0 +1,13 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published'));
+
+ALTER TABLE
+    posts
+ADD
+    COLUMN publish_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts(publish_at)
+    WHERE status = 'scheduled';
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE
+    posts
+DROP
+    COLUMN edited_at;
+
+DROP TABLE IF EXISTS post_revisions;
\ No newline at end of file
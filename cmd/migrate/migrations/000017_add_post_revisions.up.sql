@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags VARCHAR(100) [],
+    editor_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions(post_id, version);
+
+ALTER TABLE
+    posts
+ADD
+    COLUMN edited_at TIMESTAMP(0) WITH TIME ZONE;
\ No newline at end of file
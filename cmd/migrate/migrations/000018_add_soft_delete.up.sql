@@ -0,0 +1,14 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts(deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments(deleted_at)
+    WHERE deleted_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE
+    posts
+DROP
+    COLUMN visibility;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'followers', 'mentioned', 'private'));
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint REFERENCES posts(id) ON DELETE CASCADE,
+    storage_key text NOT NULL UNIQUE,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes bigint NOT NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media(post_id);
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media(user_id);
\ No newline at end of file
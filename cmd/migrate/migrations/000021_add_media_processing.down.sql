@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_media_status;
+
+ALTER TABLE media
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS blurhash,
+    DROP COLUMN IF EXISTS thumbnail_key,
+    DROP COLUMN IF EXISTS medium_key,
+    DROP COLUMN IF EXISTS updated_at;
\ No newline at end of file
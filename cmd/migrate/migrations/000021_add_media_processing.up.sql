@@ -0,0 +1,11 @@
+ALTER TABLE media
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'ready',
+    ADD COLUMN IF NOT EXISTS width int,
+    ADD COLUMN IF NOT EXISTS height int,
+    ADD COLUMN IF NOT EXISTS blurhash text,
+    ADD COLUMN IF NOT EXISTS thumbnail_key text,
+    ADD COLUMN IF NOT EXISTS medium_key text,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now();
+
+-- 待处理的图片由后台任务扫描
+CREATE INDEX IF NOT EXISTS idx_media_status ON media(status) WHERE status IN ('pending', 'processing');
\ No newline at end of file
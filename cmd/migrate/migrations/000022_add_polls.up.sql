@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS polls (
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    multiple boolean NOT NULL DEFAULT false,
+    expires_at TIMESTAMP(0) with time zone NOT NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id bigserial PRIMARY KEY,
+    poll_id bigint NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position int NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    UNIQUE (poll_id, position)
+);
+
+-- 每个用户在一个投票中只有一张选票
+CREATE TABLE IF NOT EXISTS poll_voters (
+    poll_id bigint NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (poll_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id bigint NOT NULL,
+    option_id bigint NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL,
+    PRIMARY KEY (option_id, user_id),
+    FOREIGN KEY (poll_id, user_id) REFERENCES poll_voters(poll_id, user_id) ON DELETE CASCADE
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_pinned;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS pinned_at;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(30) NOT NULL,
+    post_id bigint REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments(id) ON DELETE CASCADE,
+    read_at TIMESTAMP(0) with time zone,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+-- 重复关注和编辑帖子时不会重复通知
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_dedup ON notifications(user_id, actor_id, type, COALESCE(post_id, 0), COALESCE(comment_id, 0))
+    WHERE type IN ('follow', 'mention');
\ No newline at end of file
@@ -0,0 +1,32 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dm_policy VARCHAR(20) NOT NULL DEFAULT 'everyone';
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id bigserial PRIMARY KEY,
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    is_group boolean NOT NULL DEFAULT false,
+    title VARCHAR(100),
+    -- 一对一会话的两个成员,小的ID在前,保证同两个人只有一个会话
+    direct_key VARCHAR(50) UNIQUE,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    last_message_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id bigint NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id bigint NOT NULL DEFAULT 0,
+    joined_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id bigserial PRIMARY KEY,
+    conversation_id bigint NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content text NOT NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id, id DESC);
\ No newline at end of file
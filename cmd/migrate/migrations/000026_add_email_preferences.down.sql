@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_notifications_created_at;
+DROP TABLE IF EXISTS email_digests;
+DROP TABLE IF EXISTS email_preferences;
\ No newline at end of file
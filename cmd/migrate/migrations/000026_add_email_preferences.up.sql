@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS email_preferences (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(30) NOT NULL,
+    frequency VARCHAR(20) NOT NULL CHECK (frequency IN ('immediate', 'daily', 'weekly', 'off')),
+    PRIMARY KEY (user_id, type)
+);
+
+-- 每个用户每种摘要上一次发送的时间
+CREATE TABLE IF NOT EXISTS email_digests (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(20) NOT NULL,
+    sent_at TIMESTAMP(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, frequency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications(created_at) WHERE read_at IS NULL;
\ No newline at end of file
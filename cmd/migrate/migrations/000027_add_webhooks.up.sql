@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    url text NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events VARCHAR(50)[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    last_status_code int,
+    last_response text,
+    last_error text,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    payload jsonb NOT NULL,
+    -- 已经处理成功的handler,重试时跳过
+    handled VARCHAR(50)[] NOT NULL DEFAULT '{}',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    last_error text,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    processed_at TIMESTAMP(0) with time zone,
+    failed_at TIMESTAMP(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(next_attempt_at)
+    WHERE processed_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_processed_at ON outbox_events(processed_at) WHERE processed_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS email_jobs;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS email_jobs (
+    id bigserial PRIMARY KEY,
+    template VARCHAR(100) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    last_error text,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_due ON email_jobs(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_email_jobs_dead ON email_jobs(id DESC) WHERE status = 'dead';
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_by;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_by;
\ No newline at end of file
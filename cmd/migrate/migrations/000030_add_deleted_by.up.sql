@@ -0,0 +1,5 @@
+-- 执行删除的用户,只有自己删除的内容可以从回收站恢复
+-- 之前删除的内容不知道是谁删除的,保持NULL,不能由作者恢复
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
\ No newline at end of file
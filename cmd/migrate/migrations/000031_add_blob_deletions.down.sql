@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_media_unattached;
+
+DROP TABLE IF EXISTS blob_deletions;
\ No newline at end of file
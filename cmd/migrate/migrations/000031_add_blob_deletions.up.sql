@@ -0,0 +1,8 @@
+-- 数据库中已经删除,等待从blob存储中删除的文件
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    key text PRIMARY KEY,
+    created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT now()
+);
+
+-- 没有挂到帖子上的上传由后台任务清理
+CREATE INDEX IF NOT EXISTS idx_media_unattached ON media(created_at) WHERE post_id IS NULL;
\ No newline at end of file
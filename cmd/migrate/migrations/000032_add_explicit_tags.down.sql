@@ -0,0 +1 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS explicit_tags;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- 用户显式指定的标签,tags由它和正文中的hashtag合并得到
+-- 已有的帖子无法区分来源,正文中出现的hashtag算作来自正文
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS explicit_tags VARCHAR(100) [] NOT NULL DEFAULT '{}';
+
+UPDATE posts SET explicit_tags = ARRAY(
+    SELECT t FROM unnest(tags) AS t
+    WHERE strpos(lower(content), '#' || t) = 0
+) WHERE tags IS NOT NULL;
\ No newline at end of file
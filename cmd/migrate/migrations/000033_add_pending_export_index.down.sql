@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_outbox_events_pending_export;
\ No newline at end of file
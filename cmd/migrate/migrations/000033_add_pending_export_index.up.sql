@@ -0,0 +1,3 @@
+-- 每个用户同时只能有一个等待处理的导出请求
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_pending_export ON outbox_events ((payload->>'user_id'))
+    WHERE type = 'ExportRequested' AND processed_at IS NULL AND failed_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,49 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"identical", "a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"both empty", "", "", []Line{{Equal, ""}}},
+		{"from empty", "", "a", []Line{{Delete, ""}, {Insert, "a"}}},
+		{"append", "a", "a\nb", []Line{{Equal, "a"}, {Insert, "b"}}},
+		{"remove", "a\nb\nc", "a\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}}},
+		{"replace", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"prepend", "b", "a\nb", []Line{{Insert, "a"}, {Equal, "b"}}},
+		{"all different", "a\nb", "c", []Line{{Delete, "a"}, {Delete, "b"}, {Insert, "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// 去掉插入的行得到a,去掉删除的行得到b
+func TestLinesReconstructs(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive"
+	b := "zero\none\nthree\nfour\n4.5\nfive"
+	var gotA, gotB []string
+	for _, l := range Lines(a, b) {
+		if l.Op != Insert {
+			gotA = append(gotA, l.Text)
+		}
+		if l.Op != Delete {
+			gotB = append(gotB, l.Text)
+		}
+	}
+	if strings.Join(gotA, "\n") != a || strings.Join(gotB, "\n") != b {
+		t.Errorf("reconstructed %q and %q", gotA, gotB)
+	}
+}
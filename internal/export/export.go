@@ -0,0 +1,72 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+// 将用户数据打包成ZIP写入w
+func WriteZip(w io.Writer, data *store.UserExport) error {
+	zw := zip.NewWriter(w)
+	//JSON文件
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", data.Profile},
+		{"posts.json", data.Posts},
+		{"comments.json", data.Comments},
+		{"revisions.json", data.Revisions},
+		{"following.json", data.Following},
+		{"followers.json", data.Followers},
+		{"notifications.json", data.Notifications},
+		{"messages.json", data.Messages},
+		{"media.json", data.Media},
+		{"poll_votes.json", data.PollVotes},
+		{"email_preferences.json", data.EmailPreferences},
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, f.data); err != nil {
+			return err
+		}
+	}
+	//每个帖子额外导出一份Markdown
+	for _, post := range data.Posts {
+		fw, err := zw.Create(fmt.Sprintf("posts/%d.md", post.ID))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, postMarkdown(post)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, data any) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// 帖子的Markdown格式
+func postMarkdown(post store.Post) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", post.Title)
+	fmt.Fprintf(&b, "- created_at: %s\n", post.CreatedAt)
+	fmt.Fprintf(&b, "- updated_at: %s\n", post.UpdatedAt)
+	if len(post.Tags) > 0 {
+		fmt.Fprintf(&b, "- tags: %s\n", strings.Join(post.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "\n%s\n", post.Content)
+	return b.String()
+}
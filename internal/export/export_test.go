@@ -0,0 +1,91 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+const testSecret = "export_test"
+
+func TestVerify(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	sig := Sign(testSecret, "1-abc.zip", expires)
+	past := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		secret    string
+		file      string
+		expires   int64
+		signature string
+		want      bool
+	}{
+		{"valid", testSecret, "1-abc.zip", expires.Unix(), sig, true},
+		{"wrong secret", "other", "1-abc.zip", expires.Unix(), sig, false},
+		{"other file", testSecret, "2-abc.zip", expires.Unix(), sig, false},
+		{"extended expiry", testSecret, "1-abc.zip", expires.Unix() + 3600, sig, false},
+		{"tampered signature", testSecret, "1-abc.zip", expires.Unix(), sig[:len(sig)-1] + "0", false},
+		{"empty signature", testSecret, "1-abc.zip", expires.Unix(), "", false},
+		{"expired", testSecret, "1-abc.zip", past.Unix(), Sign(testSecret, "1-abc.zip", past), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.file, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	data := &store.UserExport{
+		Profile: &store.User{ID: 1, Username: "alice"},
+		Posts: []store.Post{
+			{ID: 7, Title: "Hello", Content: "first post", Tags: []string{"go", "db"}, CreatedAt: "2024-01-01T00:00:00Z"},
+		},
+		Comments:  []store.Comment{},
+		Following: []store.Follower{{UserID: 2, FollowerID: 1}},
+		Followers: []store.Follower{},
+	}
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, data); err != nil {
+		t.Fatalf("WriteZip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"profile.json", "posts.json", "comments.json", "following.json", "followers.json", "posts/7.md"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("zip is missing %s", name)
+		}
+	}
+	if !strings.Contains(files["profile.json"], `"username": "alice"`) {
+		t.Errorf("profile.json = %s", files["profile.json"])
+	}
+	md := files["posts/7.md"]
+	for _, want := range []string{"# Hello\n", "- tags: go, db\n", "\nfirst post\n"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("posts/7.md missing %q:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// 对下载链接签名,签名覆盖文件名和过期时间
+func Sign(secret string, name string, expires time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(name + ":" + strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 验证下载链接的签名和过期时间
+func Verify(secret string, name string, expires int64, signature string) bool {
+	exp := time.Unix(expires, 0)
+	if time.Now().After(exp) {
+		return false
+	}
+	expected := Sign(secret, name, exp)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,105 @@
+package imaging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 动图最多的帧数
+const MaxFrames = 1000
+
+// GIF的块标识
+const (
+	gifExtension  = 0x21
+	gifImage      = 0x2C
+	gifTrailer    = 0x3B
+	gifColorTable = 0x80
+)
+
+var errMalformedGIF = errors.New("malformed gif")
+
+// 只遍历GIF的块结构,不做LZW解压,得到帧数和所有帧的像素总数
+// 文件在第一帧之后被截断时按已经读到的帧计算
+func gifFrames(r io.Reader) (frames int, pixels int64, err error) {
+	br := bufio.NewReader(r)
+	//header和逻辑屏幕描述符
+	head := make([]byte, 13)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return 0, 0, errMalformedGIF
+	}
+	if err := skipColorTable(br, head[10]); err != nil {
+		return 0, 0, err
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return frames, pixels, truncated(frames, err)
+		}
+		switch b {
+		case gifExtension:
+			//标签之后是数据子块
+			if _, err := br.ReadByte(); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+		case gifImage:
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(br, desc); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+			frames++
+			pixels += int64(binary.LittleEndian.Uint16(desc[4:])) * int64(binary.LittleEndian.Uint16(desc[6:]))
+			if err := skipColorTable(br, desc[8]); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+			//LZW的最小码长,之后是图像数据子块
+			if _, err := br.ReadByte(); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return frames, pixels, truncated(frames, err)
+			}
+		case gifTrailer:
+			return frames, pixels, nil
+		default:
+			return frames, pixels, errMalformedGIF
+		}
+	}
+}
+
+// 有颜色表时跳过,大小由flags的低3位决定
+func skipColorTable(br *bufio.Reader, flags byte) error {
+	if flags&gifColorTable == 0 {
+		return nil
+	}
+	_, err := br.Discard(3 * (1 << (int(flags&0x07) + 1)))
+	return err
+}
+
+// 跳过数据子块,长度为0的子块结束
+func skipSubBlocks(br *bufio.Reader) error {
+	for {
+		n, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := br.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// 读到第一帧之后的截断不算错误,解码器同样只需要第一帧
+func truncated(frames int, err error) error {
+	if frames > 0 && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return nil
+	}
+	return errMalformedGIF
+}
@@ -0,0 +1,175 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrTooManyPixels     = errors.New("image dimensions exceed the allowed limit")
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+)
+
+// 各个版本的最长边
+const (
+	ThumbnailSize = 320
+	MediumSize    = 1280
+	//计算blurhash前先缩小,分量只需要很少的像素
+	blurhashSize = 64
+	jpegQuality  = 85
+)
+
+// 处理后的一个版本
+type Rendition struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// 图片处理的结果
+type Result struct {
+	Width    int
+	Height   int
+	Blurhash string
+	//重新编码后的原图,去掉了EXIF等元数据;动图保持原样时为nil
+	Original  *Rendition
+	Thumbnail Rendition
+	Medium    Rendition
+}
+
+// 只读取头部得到尺寸,超过maxPixels的拒绝,避免解压炸弹
+// GIF还要遍历所有帧,帧数超过MaxFrames或者所有帧的像素总数超过maxPixels的同样拒绝
+func CheckDimensions(r io.Reader, maxPixels int) (image.Config, string, error) {
+	cfg, format, _, err := checkDimensions(r, maxPixels)
+	return cfg, format, err
+}
+
+func checkDimensions(r io.Reader, maxPixels int) (image.Config, string, int, error) {
+	//DecodeConfig读过的部分留下来,GIF需要从头遍历
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return cfg, "", 0, ErrUnsupportedFormat
+		}
+		return cfg, "", 0, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > int64(maxPixels) {
+		return cfg, format, 0, ErrTooManyPixels
+	}
+	if format != "gif" {
+		return cfg, format, 1, nil
+	}
+	frames, pixels, err := gifFrames(io.MultiReader(&head, r))
+	if err != nil {
+		return cfg, format, 0, err
+	}
+	if frames > MaxFrames || pixels > int64(maxPixels) {
+		return cfg, format, frames, ErrTooManyPixels
+	}
+	return cfg, format, frames, nil
+}
+
+// 处理上传的图片:校验尺寸,按EXIF转正后重新编码,生成缩略图,中图和blurhash
+func Process(data []byte, maxPixels int) (*Result, error) {
+	_, format, frames, err := checkDimensions(bytes.NewReader(data), maxPixels)
+	if err != nil {
+		return nil, err
+	}
+	//动图重新编码会丢帧,GIF也没有EXIF,保留原文件
+	keepOriginal := frames > 1
+	//GIF只解码第一帧
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	b := img.Bounds()
+	res := &Result{Width: b.Dx(), Height: b.Dy()}
+	//保留透明通道的格式输出PNG,其他输出JPEG
+	lossless := format == "png" || format == "gif" || (format == "webp" && !isOpaque(img))
+	if !keepOriginal {
+		original, err := encode(img, lossless)
+		if err != nil {
+			return nil, err
+		}
+		res.Original = original
+	}
+	thumb, err := encode(resize(img, ThumbnailSize), lossless)
+	if err != nil {
+		return nil, err
+	}
+	res.Thumbnail = *thumb
+	medium, err := encode(resize(img, MediumSize), lossless)
+	if err != nil {
+		return nil, err
+	}
+	res.Medium = *medium
+	//横图4x3,竖图3x4
+	xc, yc := 4, 3
+	if res.Height > res.Width {
+		xc, yc = 3, 4
+	}
+	res.Blurhash, err = Blurhash(resize(img, blurhashSize), xc, yc)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// 等比缩放到最长边不超过size,不放大
+func resize(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// 编码图片,标准库的编码器不会写入任何元数据
+func encode(img image.Image, lossless bool) (*Rendition, error) {
+	var buf bytes.Buffer
+	r := &Rendition{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	if lossless {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("encoding png: %w", err)
+		}
+		r.MimeType = "image/png"
+	} else {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("encoding jpeg: %w", err)
+		}
+		r.MimeType = "image/jpeg"
+	}
+	r.Data = buf.Bytes()
+	return r, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func pngImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func jpegImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// frames帧,每帧w*h的GIF
+func animatedGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9))
+		g.Delay = append(g.Delay, 1)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckDimensions(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		format    string
+		frames    int
+		err       error
+	}{
+		{"png within limit", pngImage(t, 40, 30), 1200, "png", 1, nil},
+		{"png over limit", pngImage(t, 40, 31), 1200, "png", 0, ErrTooManyPixels},
+		{"jpeg", jpegImage(t, 16, 16), 1000, "jpeg", 1, nil},
+		{"static gif", animatedGIF(t, 10, 10, 1), 1000, "gif", 1, nil},
+		{"animated gif", animatedGIF(t, 10, 10, 5), 1000, "gif", 5, nil},
+		//每一帧都在限制以内,所有帧加起来超过
+		{"gif frames over pixel budget", animatedGIF(t, 10, 10, 11), 1000, "gif", 11, ErrTooManyPixels},
+		{"gif over frame limit", animatedGIF(t, 1, 1, MaxFrames+1), 1 << 20, "gif", MaxFrames + 1, ErrTooManyPixels},
+		{"not an image", []byte("hello world"), 1000, "", 0, ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, format, frames, err := checkDimensions(bytes.NewReader(tt.data), tt.maxPixels)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == ErrUnsupportedFormat {
+				return
+			}
+			if format != tt.format {
+				t.Errorf("format = %q, want %q", format, tt.format)
+			}
+			if tt.err == nil && frames != tt.frames {
+				t.Errorf("frames = %d, want %d", frames, tt.frames)
+			}
+		})
+	}
+}
+
+func TestGIFFramesTruncated(t *testing.T) {
+	data := animatedGIF(t, 10, 10, 3)
+	//去掉结尾的trailer和最后一帧的一部分
+	frames, _, err := gifFrames(bytes.NewReader(data[:len(data)-10]))
+	if err != nil {
+		t.Fatalf("gifFrames: %v", err)
+	}
+	if frames < 2 || frames > 3 {
+		t.Errorf("frames = %d, want 2 or 3", frames)
+	}
+	if _, _, err := gifFrames(bytes.NewReader(data[:8])); err == nil {
+		t.Error("gifFrames accepted a truncated header")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		keepOriginal bool
+		mimeType     string
+	}{
+		{"png", pngImage(t, 2000, 1000), false, "image/png"},
+		{"jpeg", jpegImage(t, 2000, 1000), false, "image/jpeg"},
+		{"animated gif", animatedGIF(t, 2000, 1000, 2), true, "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Process(tt.data, 1<<24)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if res.Width != 2000 || res.Height != 1000 {
+				t.Errorf("size = %dx%d, want 2000x1000", res.Width, res.Height)
+			}
+			if (res.Original == nil) != tt.keepOriginal {
+				t.Errorf("Original = %v, want kept original %v", res.Original != nil, tt.keepOriginal)
+			}
+			if res.Thumbnail.Width != ThumbnailSize || res.Thumbnail.Height != ThumbnailSize/2 {
+				t.Errorf("thumbnail = %dx%d", res.Thumbnail.Width, res.Thumbnail.Height)
+			}
+			if res.Medium.Width != MediumSize || res.Medium.MimeType != tt.mimeType {
+				t.Errorf("medium = %d %s, want %d %s", res.Medium.Width, res.Medium.MimeType, MediumSize, tt.mimeType)
+			}
+			if res.Blurhash == "" {
+				t.Error("missing blurhash")
+			}
+		})
+	}
+}
@@ -3,18 +3,25 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "looksaw"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName             = "looksaw"
+	maxRetries           = 3
+	UserWelcomeTemplate  = "user_invitation.tmpl"
+	UserExportTemplate   = "user_data_export.tmpl"
+	NotificationTemplate = "notification.tmpl"
+	DigestTemplate       = "notification_digest.tmpl"
 )
 
 //go:embed "templates"
 var FS embed.FS
 
+// 额外的邮件头
+type Header map[string]string
+
 type Client interface {
 	Send(templateFile string,
 		username string,
 		email string,
 		data any,
+		header Header,
 		isSandbox bool) (int, error)
 }
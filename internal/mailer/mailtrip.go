@@ -27,7 +27,7 @@ func NewMailTrapClient(apiKey string, fromEmail string) (mailTripClient, error)
 }
 
 // 发送邮件
-func (m mailTripClient) Send(templateFile string, username string, email string, data any, isSandbox bool) (int, error) {
+func (m mailTripClient) Send(templateFile string, username string, email string, data any, header Header, isSandbox bool) (int, error) {
 	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
 	if err != nil {
 		return -1, err
@@ -47,6 +47,9 @@ func (m mailTripClient) Send(templateFile string, username string, email string,
 	message.SetHeader("From", m.fromEmail)
 	message.SetHeader("To", email)
 	message.SetHeader("Subject", subject.String())
+	for k, v := range header {
+		message.SetHeader(k, v)
+	}
 
 	message.AddAlternative("text/html", body.String())
 	dialer := gomail.NewDialer("live.smtp.mailtrap.io", 587, "api", m.apiKey)
@@ -0,0 +1,20 @@
+package mailer
+
+import "time"
+
+const (
+	//发送队列中的邮件超过这个次数不再重试,进入死信
+	MaxQueueAttempts = 8
+	//第一次重试的等待时间,之后每次翻倍
+	baseQueueBackoff = time.Second * 30
+	maxQueueBackoff  = time.Hour
+)
+
+// 第attempt次发送失败之后等待多久再重试,attempt从1开始
+func Backoff(attempt int) time.Duration {
+	d := baseQueueBackoff
+	for i := 1; i < attempt && d < maxQueueBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxQueueBackoff)
+}
@@ -32,6 +32,7 @@ func (m *SendGridMailer) Send(templateFile string,
 	username string,
 	email string,
 	data any,
+	header Header,
 	isSandbox bool) error {
 	//发邮件的地址
 	from := mail.NewEmail(FromName, m.fromEmail)
@@ -54,6 +55,9 @@ func (m *SendGridMailer) Send(templateFile string,
 		return err
 	}
 	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	for k, v := range header {
+		message.SetHeader(k, v)
+	}
 	//设置沙盒模式
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
@@ -63,7 +67,7 @@ func (m *SendGridMailer) Send(templateFile string,
 	for i := 0; i < maxRetries; i++ {
 		response, err := m.client.Send(message)
 		if err != nil {
-			log.Printf("Failed to send email to %v attempt &d of %d\n", email, i+1, maxRetries)
+			log.Printf("Failed to send email to %v attempt %d of %d\n", email, i+1, maxRetries)
 			log.Printf("Err is %v", err)
 			//退避重试
 			time.Sleep(time.Second * time.Duration(i+1))
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// 退订全部通知邮件
+const UnsubscribeAll = "all"
+
+// 对退订链接签名,签名覆盖用户和退订的通知类型,链接不会过期
+func SignUnsubscribe(secret string, userID int64, kind string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + strconv.FormatInt(userID, 10) + ":" + kind))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 验证退订链接的签名
+func VerifyUnsubscribe(secret string, userID int64, kind string, signature string) bool {
+	expected := SignUnsubscribe(secret, userID, kind)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// 邮件客户端一键退订用的邮件头(RFC 8058),客户端会向链接发送POST
+func UnsubscribeHeader(url string) Header {
+	return Header{
+		"List-Unsubscribe":      "<" + url + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import "testing"
+
+const testSecret = "unsubscribe_test"
+
+func TestVerifyUnsubscribe(t *testing.T) {
+	sig := SignUnsubscribe(testSecret, 7, "comment")
+	tests := []struct {
+		name      string
+		secret    string
+		userID    int64
+		kind      string
+		signature string
+		want      bool
+	}{
+		{"valid", testSecret, 7, "comment", sig, true},
+		{"wrong secret", "other", 7, "comment", sig, false},
+		{"other user", testSecret, 8, "comment", sig, false},
+		{"other type", testSecret, 7, UnsubscribeAll, sig, false},
+		{"tampered signature", testSecret, 7, "comment", sig[:len(sig)-1] + "0", false},
+		{"empty signature", testSecret, 7, "comment", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyUnsubscribe(tt.secret, tt.userID, tt.kind, tt.signature); got != tt.want {
+				t.Errorf("VerifyUnsubscribe = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeHeader(t *testing.T) {
+	h := UnsubscribeHeader("https://example.com/v1/email/unsubscribe?user=1&type=all&signature=abc")
+	if got, want := h["List-Unsubscribe"], "<https://example.com/v1/email/unsubscribe?user=1&type=all&signature=abc>"; got != want {
+		t.Errorf("List-Unsubscribe = %q, want %q", got, want)
+	}
+	if got, want := h["List-Unsubscribe-Post"], "List-Unsubscribe=One-Click"; got != want {
+		t.Errorf("List-Unsubscribe-Post = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// 用户内容里链接的rel
+const linkRel = "nofollow ugc"
+
+var (
+	//正文中的原始HTML按文字输出,只有Markdown本身生成的标签
+	renderer = goldmark.New(
+		goldmark.WithExtensions(extension.Strikethrough, extension.Linkify),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(relTransformer{}, 100)),
+		),
+		goldmark.WithRendererOptions(
+			gmhtml.WithHardWraps(),
+			gmrenderer.WithNodeRenderers(util.Prioritized(escapeHTMLRenderer{}, 100)),
+		),
+	)
+	policy = newPolicy()
+)
+
+// 把Markdown渲染成经过清洗的HTML
+func Render(src string) string {
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(src), &buf); err != nil {
+		//渲染失败时退回纯文本
+		return "<p>" + html.EscapeString(src) + "</p>"
+	}
+	return policy.Sanitize(buf.String())
+}
+
+// 允许的Markdown子集:段落,强调,删除线,代码,引用,列表和链接;标题只保留文字,图片去掉
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "strong", "em", "del", "code", "pre", "blockquote", "ul", "ol", "li")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^nofollow ugc$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	//兜底,rel已经包含nofollow时不会再修改
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// 给所有链接加上rel
+type relTransformer struct{}
+
+func (relTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.Link, *ast.AutoLink:
+			n.SetAttributeString("rel", []byte(linkRel))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// 把原始HTML转义成文字,默认的渲染器会直接丢掉
+type escapeHTMLRenderer struct{}
+
+func (escapeHTMLRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHTMLBlock, renderHTMLBlock)
+	reg.Register(ast.KindRawHTML, renderRawHTML)
+}
+
+// HTML块作为一个段落输出,每一行之间换行
+func renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.HTMLBlock)
+	var lines []string
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		lines = append(lines, strings.TrimRight(string(line.Value(source)), "\r\n"))
+	}
+	if n.HasClosure() {
+		lines = append(lines, strings.TrimRight(string(n.ClosureLine.Value(source)), "\r\n"))
+	}
+	_, _ = w.WriteString("<p>")
+	for i, line := range lines {
+		if i > 0 {
+			_, _ = w.WriteString("<br>\n")
+		}
+		_, _ = w.WriteString(html.EscapeString(line))
+	}
+	_, _ = w.WriteString("</p>\n")
+	return ast.WalkContinue, nil
+}
+
+// 行内的HTML标签
+func renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		_, _ = w.WriteString(html.EscapeString(string(segment.Value(source))))
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,49 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraph", "hello *world*", "<p>hello <em>world</em></p>\n"},
+		{"link rel", "[site](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc">site</a></p>` + "\n"},
+		{"autolink rel", "see https://example.com", `<p>see <a href="https://example.com" rel="nofollow ugc">https://example.com</a></p>` + "\n"},
+		{"javascript href removed", "[x](javascript:alert(1))", `<p><a rel="nofollow ugc">x</a></p>` + "\n"},
+		{"image removed", "![alt](https://example.com/a.png)", "<p></p>\n"},
+		{"heading kept as text", "# title", "title\n"},
+		{"inline html escaped", "a <b>bold</b> word", "<p>a &lt;b&gt;bold&lt;/b&gt; word</p>\n"},
+		{
+			"html block escaped",
+			`<script>alert(1)</script> <a href="https://example.com">raw</a>`,
+			"<p>&lt;script&gt;alert(1)&lt;/script&gt; &lt;a href=&#34;https://example.com&#34;&gt;raw&lt;/a&gt;</p>\n",
+		},
+		{"multi-line html block", "<div>\none\n</div>", "<p>&lt;div&gt;<br>\none<br>\n&lt;/div&gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderNeverEmitsScript(t *testing.T) {
+	for _, src := range []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[x](javascript:alert(1))",
+		`<a href="javascript:alert(1)">x</a>`,
+	} {
+		got := Render(src)
+		if strings.Contains(got, "<script") || strings.Contains(got, "<img") || strings.Contains(got, `href="javascript`) {
+			t.Errorf("Render(%q) = %q", src, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/looksaw/social/internal/store"
+)
+
+const (
+	//超过这个次数不再重试,事件标记为失败
+	MaxAttempts = 10
+	//第一次重试的等待时间,之后每次翻倍
+	baseBackoff = time.Second * 5
+	maxBackoff  = time.Minute * 30
+)
+
+// 处理一种事件,返回错误时事件稍后重试
+// 同一个事件可能被处理不止一次,handler需要能够承受重复
+type Handler func(ctx context.Context, ev store.OutboxEvent) error
+
+// 发件箱的存储
+type Store interface {
+	ClaimDue(context.Context, time.Duration, int) ([]store.OutboxEvent, error)
+	RecordAttempt(context.Context, *store.OutboxEvent) error
+}
+
+type namedHandler struct {
+	name string
+	fn   Handler
+}
+
+// 把发件箱中的事件分发给进程内的handler
+// 每个handler单独记录是否成功,重试时只执行失败的handler
+type Dispatcher struct {
+	store     Store
+	lease     time.Duration
+	batchSize int
+	handlers  map[string][]namedHandler
+	onError   func(ev store.OutboxEvent, handler string, err error)
+}
+
+// 新建分发者,lease是领取的事件被独占的时间,需要长于处理一批事件的时间
+func NewDispatcher(s Store, lease time.Duration, batchSize int, onError func(store.OutboxEvent, string, error)) *Dispatcher {
+	return &Dispatcher{
+		store:     s,
+		lease:     lease,
+		batchSize: batchSize,
+		handlers:  map[string][]namedHandler{},
+		onError:   onError,
+	}
+}
+
+// 注册handler,name在同一种事件中必须唯一,只能在Dispatch之前调用
+func (d *Dispatcher) Handle(eventType string, name string, fn Handler) {
+	for _, h := range d.handlers[eventType] {
+		if h.name == name {
+			panic(fmt.Sprintf("outbox: duplicate handler %q for %s", name, eventType))
+		}
+	}
+	d.handlers[eventType] = append(d.handlers[eventType], namedHandler{name: name, fn: fn})
+}
+
+// 处理所有到期的事件,直到没有到期的事件
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	for {
+		events, err := d.store.ClaimDue(ctx, d.lease, d.batchSize)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			d.dispatch(ctx, &events[i])
+			if err := d.store.RecordAttempt(ctx, &events[i]); err != nil {
+				return err
+			}
+		}
+		if len(events) < d.batchSize {
+			return nil
+		}
+	}
+}
+
+// 执行还没有成功的handler,并决定事件的下一步
+func (d *Dispatcher) dispatch(ctx context.Context, ev *store.OutboxEvent) {
+	var lastErr error
+	for _, h := range d.handlers[ev.Type] {
+		if slices.Contains(ev.Handled, h.name) {
+			continue
+		}
+		if err := call(ctx, h.fn, *ev); err != nil {
+			lastErr = err
+			if d.onError != nil {
+				d.onError(*ev, h.name, err)
+			}
+			continue
+		}
+		ev.Handled = append(ev.Handled, h.name)
+	}
+	ev.LastError = nil
+	ev.NextAttemptAt = time.Now()
+	if lastErr == nil {
+		ev.Processed = true
+		return
+	}
+	msg := lastErr.Error()
+	ev.LastError = &msg
+	attempt := ev.Attempts + 1
+	if attempt >= MaxAttempts {
+		ev.Failed = true
+		return
+	}
+	ev.NextAttemptAt = time.Now().Add(backoff(attempt))
+}
+
+// handler中的panic当作错误处理,不影响其他事件
+func call(ctx context.Context, fn Handler, ev store.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, ev)
+}
+
+// 第attempt次失败之后等待多久再重试,attempt从1开始
+func backoff(attempt int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
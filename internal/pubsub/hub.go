@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+var ErrPayloadTooLarge = errors.New("event payload is too large")
+
+// 推送给客户端的事件
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// 发布事件,多实例部署时需要经过数据库广播
+type Publisher interface {
+	Publish(ctx context.Context, ev Event) error
+}
+
+// 每个订阅缓冲的事件数
+const subscriptionBuffer = 64
+
+// 进程内的订阅中心,按topic分发事件
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[string]map[*Subscription]struct{}{}}
+}
+
+// 订阅一组topic
+func (h *Hub) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		topics: topics,
+		ch:     make(chan Event, subscriptionBuffer),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range topics {
+		if h.subs[t] == nil {
+			h.subs[t] = map[*Subscription]struct{}{}
+		}
+		h.subs[t][s] = struct{}{}
+	}
+	return s
+}
+
+// 把事件分发给本进程的订阅者
+// 消费太慢,缓冲区已满的订阅会被关闭,客户端重连之后重新拉取
+func (h *Hub) Publish(ev Event) {
+	var slow []*Subscription
+	h.mu.RLock()
+	for s := range h.subs[ev.Topic] {
+		select {
+		case s.ch <- ev:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+	for _, s := range slow {
+		s.Close()
+	}
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range s.topics {
+		delete(h.subs[t], s)
+		if len(h.subs[t]) == 0 {
+			delete(h.subs, t)
+		}
+	}
+}
+
+// 一个订阅
+type Subscription struct {
+	hub    *Hub
+	topics []string
+	ch     chan Event
+	once   sync.Once
+}
+
+// 事件的channel,订阅被关闭时channel也会关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// 取消订阅,可以重复调用
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.remove(s)
+		close(s.ch)
+	})
+}
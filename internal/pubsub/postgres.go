@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NOTIFY使用的channel
+const pgChannel = "social_events"
+
+// NOTIFY的payload不能超过8000字节
+const maxPayload = 8000
+
+// 通过Postgres的LISTEN/NOTIFY把事件广播给所有实例,包括自己
+type PGBridge struct {
+	dsn     string
+	db      *sql.DB
+	hub     *Hub
+	onError func(error)
+}
+
+func NewPGBridge(dsn string, db *sql.DB, hub *Hub, onError func(error)) *PGBridge {
+	return &PGBridge{
+		dsn:     dsn,
+		db:      db,
+		hub:     hub,
+		onError: onError,
+	}
+}
+
+// 发布事件,本实例的订阅者也通过LISTEN收到
+func (b *PGBridge) Publish(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		return ErrPayloadTooLarge
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, pgChannel, string(payload))
+	return err
+}
+
+// 监听并分发事件,直到ctx被取消,断线时pq.Listener会自动重连
+func (b *PGBridge) Run(ctx context.Context) error {
+	listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			b.onError(err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(pgChannel); err != nil {
+		return err
+	}
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			//重连之后会收到nil,期间的事件已经丢失
+			if n == nil {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				b.onError(err)
+				continue
+			}
+			b.hub.Publish(ev)
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				b.onError(err)
+			}
+		}
+	}
+}
@@ -8,14 +8,18 @@ import (
 
 // Comments的模型
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID      int64  `json:"id"`
+	PostID  int64  `json:"post_id"`
+	UserID  int64  `json:"user_id"`
+	Content string `json:"content"`
+	//由Content渲染的HTML,只读,回写之前由API层填充
+	ContentHTML string `json:"content_html"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
 	//链接的外表
 	User User `json:"user"`
+	//评论中的@提及
+	Mentions []Mention `json:"mentions"`
 }
 
 // Comments的存储
@@ -29,7 +33,7 @@ func (s *CommentsStore) GetPostByID(ctx context.Context, postID int64) ([]Commen
 		`
 		SELECT c.id,c.post_id,c.user_id,c.content,c.created_at,c.updated_at,users.username,users.id FROM comments c
 		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
+		WHERE c.post_id = $1 AND c.deleted_at IS NULL
 		ORDER BY c.created_at DESC;
 	`
 	// 开始查询
@@ -69,6 +73,25 @@ func (s *CommentsStore) GetPostByID(ctx context.Context, postID int64) ([]Commen
 
 // 创建评论
 func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, comment); err != nil {
+			return err
+		}
+		//解析评论中的提及
+		mentions, err := saveMentions(ctx, tx, comment.UserID, comment.PostID, &comment.ID, comment.Content)
+		if err != nil {
+			return err
+		}
+		comment.Mentions = mentions
+		return addEvent(ctx, tx, EventCommentCreated, CommentCreated{
+			CommentID: comment.ID,
+			PostID:    comment.PostID,
+			UserID:    comment.UserID,
+		})
+	})
+}
+
+func (s *CommentsStore) create(ctx context.Context, tx *sql.Tx, comment *Comment) error {
 	//创建的SQL语句
 	query := `
 		INSERT INTO comments (post_id, user_id, content)
@@ -79,7 +102,7 @@ func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	//执行SQL
-	err := s.db.QueryRowContext(
+	err := tx.QueryRowContext(
 		ctx,
 		query,
 		comment.PostID,
@@ -95,3 +118,53 @@ func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
 	}
 	return nil
 }
+
+// 通过ID得到评论
+func (s *CommentsStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	query := `
+		SELECT id , post_id , user_id , content , created_at , updated_at
+		FROM comments WHERE id = $1 AND deleted_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	comment := &Comment{}
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.UserID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return comment, nil
+}
+
+// 软删除评论,deletedBy是执行删除的用户
+func (s *CommentsStore) Delete(ctx context.Context, commentID int64, deletedBy int64) error {
+	query := `
+		UPDATE comments SET deleted_at = now() , deleted_by = $2 , updated_at = now()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, commentID, deletedBy)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 邮件通知的频率
+const (
+	EmailImmediate = "immediate"
+	EmailDaily     = "daily"
+	EmailWeekly    = "weekly"
+	EmailOff       = "off"
+)
+
+// 没有设置过的通知类型使用的频率
+const DefaultEmailFrequency = EmailDaily
+
+// 可以设置邮件偏好的通知类型
+var NotificationTypes = []string{NotificationFollow, NotificationComment, NotificationMention}
+
+// 需要立即发送邮件的通知,带上接收者和触发者的信息
+type NotificationEmail struct {
+	Notification
+	Username      string
+	Email         string
+	ActorUsername string
+}
+
+// 一封摘要邮件,Since之后的未读通知按组汇总
+type Digest struct {
+	UserID   int64
+	Username string
+	Email    string
+	Since    time.Time
+	Groups   []NotificationGroup
+}
+
+// 邮件偏好的存储
+type EmailPreferenceStore struct {
+	db *sql.DB
+}
+
+// 得到用户每种通知的邮件频率,没有设置过的使用默认值
+func (s *EmailPreferenceStore) Get(ctx context.Context, userID int64) (map[string]string, error) {
+	query := `SELECT type , frequency FROM email_preferences WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	prefs := make(map[string]string, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = DefaultEmailFrequency
+	}
+	for rows.Next() {
+		var t, frequency string
+		if err := rows.Scan(&t, &frequency); err != nil {
+			return nil, err
+		}
+		prefs[t] = frequency
+	}
+	return prefs, rows.Err()
+}
+
+// 修改邮件偏好,prefs中没有的类型保持不变,用户已经不存在时忽略
+func (s *EmailPreferenceStore) Set(ctx context.Context, userID int64, prefs map[string]string) error {
+	if len(prefs) == 0 {
+		return nil
+	}
+	types := make([]string, 0, len(prefs))
+	frequencies := make([]string, 0, len(prefs))
+	for t, frequency := range prefs {
+		types = append(types, t)
+		frequencies = append(frequencies, frequency)
+	}
+	query := `
+		INSERT INTO email_preferences (user_id , type , frequency)
+		SELECT $1 , t.type , t.frequency FROM unnest($2::varchar[] , $3::varchar[]) AS t(type , frequency)
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = $1)
+		ON CONFLICT (user_id , type) DO UPDATE SET frequency = EXCLUDED.frequency
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, pq.Array(types), pq.Array(frequencies))
+	return err
+}
+
+// 这些通知中接收者选择了立即发送邮件的
+func (s *EmailPreferenceStore) ImmediateEmails(ctx context.Context, notificationIDs []int64) ([]NotificationEmail, error) {
+	query := `
+		SELECT n.id , n.user_id , n.actor_id , n.type , n.post_id , n.comment_id , n.created_at ,
+			u.username , u.email , a.username
+		FROM notifications n
+		JOIN users u ON u.id = n.user_id
+		JOIN users a ON a.id = n.actor_id
+		LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.type = n.type
+		WHERE n.id = ANY($1) AND u.is_active AND COALESCE(ep.frequency , $2) = 'immediate'
+		ORDER BY n.id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(notificationIDs), DefaultEmailFrequency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := []NotificationEmail{}
+	for rows.Next() {
+		var e NotificationEmail
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.ActorID,
+			&e.Type,
+			&e.PostID,
+			&e.CommentID,
+			&e.CreatedAt,
+			&e.Username,
+			&e.Email,
+			&e.ActorUsername,
+		)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+// 到期的摘要邮件,按用户ID分页
+// due之前发送过或者从未发送过的用户到期,从未发送过的用户汇总window之后的通知
+func (s *EmailPreferenceStore) DueDigests(ctx context.Context, frequency string, due time.Time, window time.Time, afterID int64, limit int) ([]Digest, error) {
+	query := `
+		WITH due AS (
+			SELECT u.id , u.username , u.email , COALESCE(d.sent_at , $3) AS since
+			FROM users u
+			LEFT JOIN email_digests d ON d.user_id = u.id AND d.frequency = $1
+			WHERE u.is_active AND u.id > $5 AND (d.sent_at IS NULL OR d.sent_at <= $2) AND EXISTS (
+				SELECT 1 FROM notifications n
+				LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.type = n.type
+				LEFT JOIN posts p ON p.id = n.post_id
+				WHERE n.user_id = u.id AND n.read_at IS NULL AND n.created_at > COALESCE(d.sent_at , $3) AND
+					COALESCE(ep.frequency , $4) = $1 AND (n.post_id IS NULL OR p.deleted_at IS NULL))
+			ORDER BY u.id
+			LIMIT $6
+		)
+		SELECT due.id , due.username , due.email , due.since ,
+			MAX(n.id) , n.type , n.post_id , COUNT(*) , COUNT(DISTINCT n.actor_id) , MAX(n.created_at) ,
+			array_agg(n.actor_id ORDER BY n.id DESC) ,
+			array_agg(a.username ORDER BY n.id DESC)
+		FROM due
+		JOIN notifications n ON n.user_id = due.id
+		JOIN users a ON a.id = n.actor_id
+		LEFT JOIN email_preferences ep ON ep.user_id = n.user_id AND ep.type = n.type
+		LEFT JOIN posts p ON p.id = n.post_id
+		WHERE n.read_at IS NULL AND n.created_at > due.since AND
+			COALESCE(ep.frequency , $4) = $1 AND (n.post_id IS NULL OR p.deleted_at IS NULL)
+		GROUP BY due.id , due.username , due.email , due.since , n.type , n.post_id
+		ORDER BY due.id , MAX(n.id) DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, frequency, due, window, DefaultEmailFrequency, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	digests := []Digest{}
+	for rows.Next() {
+		var (
+			d         Digest
+			g         NotificationGroup
+			actorIDs  []int64
+			usernames []string
+		)
+		err := rows.Scan(
+			&d.UserID,
+			&d.Username,
+			&d.Email,
+			&d.Since,
+			&g.ID,
+			&g.Type,
+			&g.PostID,
+			&g.Count,
+			&g.ActorCount,
+			&g.LatestAt,
+			pq.Array(&actorIDs),
+			pq.Array(&usernames),
+		)
+		if err != nil {
+			return nil, err
+		}
+		g.Actors = latestActors(actorIDs, usernames)
+		//同一个用户的组是连续的
+		if len(digests) == 0 || digests[len(digests)-1].UserID != d.UserID {
+			digests = append(digests, d)
+		}
+		last := &digests[len(digests)-1]
+		last.Groups = append(last.Groups, g)
+	}
+	return digests, rows.Err()
+}
+
+// 记录摘要邮件的发送时间,下一封摘要从这个时间开始
+func (s *EmailPreferenceStore) MarkDigestSent(ctx context.Context, userID int64, frequency string, sentAt time.Time) error {
+	query := `
+		INSERT INTO email_digests (user_id , frequency , sent_at) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id , frequency) DO UPDATE SET sent_at = EXCLUDED.sent_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, frequency, sentAt)
+	return err
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// 邮件任务的状态
+const (
+	EmailJobPending = "pending"
+	EmailJobSent    = "sent"
+	EmailJobDead    = "dead" //重试次数用完,需要人工处理
+)
+
+// 等待发送的邮件,Data是渲染模板用的变量,不返回给客户端
+// 激活链接这类带token的变量在发送时才生成,不写入Data
+type EmailJob struct {
+	ID            int64           `json:"id"`
+	Template      string          `json:"template"`
+	Username      string          `json:"username"`
+	Email         string          `json:"email"`
+	Data          json.RawMessage `json:"-"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     *string         `json:"last_error"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+}
+
+const emailJobColumns = `id , template , username , email , data , status , attempts , next_attempt_at ,
+		last_error , created_at , updated_at`
+
+// 按emailJobColumns的顺序扫描
+func scanEmailJob(row interface{ Scan(...any) error }, j *EmailJob) error {
+	return row.Scan(
+		&j.ID,
+		&j.Template,
+		&j.Username,
+		&j.Email,
+		&j.Data,
+		&j.Status,
+		&j.Attempts,
+		&j.NextAttemptAt,
+		&j.LastError,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+	)
+}
+
+// 邮件任务的存储
+type EmailJobStore struct {
+	db *sql.DB
+}
+
+// 加入发送队列
+func (s *EmailJobStore) Enqueue(ctx context.Context, job *EmailJob) error {
+	query := `
+		INSERT INTO email_jobs (template , username , email , data)
+		VALUES ($1,$2,$3,$4) RETURNING id , status , next_attempt_at , created_at , updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		job.Template,
+		job.Username,
+		job.Email,
+		string(job.Data),
+	).Scan(&job.ID, &job.Status, &job.NextAttemptAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// 领取一个到期的任务,没有时返回ErrNotFound
+// 领取的任务在lease之内不会被其他worker领取
+func (s *EmailJobStore) ClaimNext(ctx context.Context, lease time.Duration) (*EmailJob, error) {
+	query := `
+		UPDATE email_jobs SET next_attempt_at = now() + make_interval(secs => $1) , updated_at = now()
+		WHERE id = (
+			SELECT id FROM email_jobs
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + emailJobColumns
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	job := &EmailJob{}
+	if err := scanEmailJob(s.db.QueryRowContext(ctx, query, lease.Seconds()), job); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// 记录一次发送的结果,job.Status和job.NextAttemptAt由调用者决定
+// 发送成功后清空模板变量,里面有用户名和通知内容
+func (s *EmailJobStore) RecordAttempt(ctx context.Context, job *EmailJob) error {
+	query := `
+		UPDATE email_jobs
+		SET status = $2 , attempts = attempts + 1 , next_attempt_at = $3 , last_error = $4 ,
+			data = CASE WHEN $2 = 'sent' THEN '{}' ELSE data END , updated_at = now()
+		WHERE id = $1
+		RETURNING attempts , updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		job.ID,
+		job.Status,
+		job.NextAttemptAt,
+		job.LastError,
+	).Scan(&job.Attempts, &job.UpdatedAt)
+}
+
+// 死信任务,按ID倒序,before为0时从最新的开始
+func (s *EmailJobStore) GetDead(ctx context.Context, before int64, limit int) ([]EmailJob, error) {
+	query := `
+		SELECT ` + emailJobColumns + `
+		FROM email_jobs
+		WHERE status = 'dead' AND ($1 = 0 OR id < $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []EmailJob{}
+	for rows.Next() {
+		var j EmailJob
+		if err := scanEmailJob(rows, &j); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// 重新发送死信任务,重试次数从头计算
+func (s *EmailJobStore) Retry(ctx context.Context, id int64) (*EmailJob, error) {
+	query := `
+		UPDATE email_jobs SET status = 'pending' , attempts = 0 , next_attempt_at = now() , updated_at = now()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING ` + emailJobColumns
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	job := &EmailJob{}
+	if err := scanEmailJob(s.db.QueryRowContext(ctx, query, id), job); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// 删除before之前发送成功的任务
+func (s *EmailJobStore) PurgeSent(ctx context.Context, before time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM email_jobs WHERE status = 'sent' AND updated_at < $1`, before)
+	return err
+}
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var ErrExportPending = errors.New("an export is already in progress")
+
+// 导出的用户数据
+type UserExport struct {
+	Profile   *User      `json:"profile"`
+	Posts     []Post     `json:"posts"`
+	Comments  []Comment  `json:"comments"`
+	Revisions []Revision `json:"revisions"`
+	Following []Follower `json:"following"`
+	Followers []Follower `json:"followers"`
+	//收到的通知
+	Notifications []Notification `json:"notifications"`
+	//所在会话中的全部私信,包括收到的
+	Messages []Message `json:"messages"`
+	//上传的媒体文件,只有元数据
+	Media []Media `json:"media"`
+	//投过的票
+	PollVotes []ExportPollVote `json:"poll_votes"`
+	//每种通知的邮件频率
+	EmailPreferences map[string]string `json:"email_preferences"`
+}
+
+// 导出中的一张选票
+type ExportPollVote struct {
+	PollID   int64  `json:"poll_id"`
+	PostID   int64  `json:"post_id"`
+	OptionID int64  `json:"option_id"`
+	Option   string `json:"option"`
+	VotedAt  string `json:"voted_at"`
+}
+
+// 导出数据的存储
+type ExportStorage struct {
+	db *sql.DB
+}
+
+// 申请导出,导出由发件箱的handler在后台完成
+// 已经有等待处理的导出时返回ErrExportPending
+func (s *ExportStorage) Request(ctx context.Context, userID int64) error {
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return addEvent(ctx, tx, EventExportRequested, ExportRequested{UserID: userID})
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrExportPending
+	}
+	return err
+}
+
+// 收集用户的全部个人数据
+func (s *ExportStorage) Collect(ctx context.Context, userID int64) (*UserExport, error) {
+	export := &UserExport{}
+	//个人资料
+	profile, err := s.profile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Profile = profile
+	//帖子
+	if export.Posts, err = s.posts(ctx, userID); err != nil {
+		return nil, err
+	}
+	//评论
+	if export.Comments, err = s.comments(ctx, userID); err != nil {
+		return nil, err
+	}
+	//编辑历史
+	if export.Revisions, err = s.revisions(ctx, userID); err != nil {
+		return nil, err
+	}
+	//关注的人
+	if export.Following, err = s.follows(ctx, `SELECT user_id , follower_id , created_at , updated_at FROM followers WHERE follower_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	//粉丝
+	if export.Followers, err = s.follows(ctx, `SELECT user_id , follower_id , created_at , updated_at FROM followers WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	//通知
+	if export.Notifications, err = s.notifications(ctx, userID); err != nil {
+		return nil, err
+	}
+	//私信
+	if export.Messages, err = s.messages(ctx, userID); err != nil {
+		return nil, err
+	}
+	//媒体文件
+	if export.Media, err = s.media(ctx, userID); err != nil {
+		return nil, err
+	}
+	//投票
+	if export.PollVotes, err = s.pollVotes(ctx, userID); err != nil {
+		return nil, err
+	}
+	//邮件偏好
+	prefs := &EmailPreferenceStore{db: s.db}
+	if export.EmailPreferences, err = prefs.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *ExportStorage) profile(ctx context.Context, userID int64) (*User, error) {
+	query := `
+		SELECT id , username , email , created_at , updated_at , is_active , role_id , dm_policy
+		FROM users WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	user := &User{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+		&user.RoleID,
+		&user.DMPolicy,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *ExportStorage) posts(ctx context.Context, userID int64) ([]Post, error) {
+	query := `
+		SELECT id , user_id , title , content , tags , created_at , updated_at , version
+		FROM posts WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func (s *ExportStorage) comments(ctx context.Context, userID int64) ([]Comment, error) {
+	query := `
+		SELECT id , post_id , user_id , content , created_at , updated_at
+		FROM comments WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *ExportStorage) revisions(ctx context.Context, userID int64) ([]Revision, error) {
+	query := `
+		SELECT r.id , r.post_id , r.version , r.title , r.content , r.tags , r.editor_id , r.created_at
+		FROM post_revisions r
+		JOIN posts p ON p.id = r.post_id
+		WHERE p.user_id = $1
+		ORDER BY r.post_id , r.version
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []Revision{}
+	for rows.Next() {
+		var r Revision
+		err := rows.Scan(
+			&r.ID,
+			&r.PostID,
+			&r.Version,
+			&r.Title,
+			&r.Content,
+			pq.Array(&r.Tags),
+			&r.EditorID,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *ExportStorage) follows(ctx context.Context, query string, userID int64) ([]Follower, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	follows := []Follower{}
+	for rows.Next() {
+		var f Follower
+		if err := rows.Scan(&f.UserID, &f.FollowerID, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+func (s *ExportStorage) notifications(ctx context.Context, userID int64) ([]Notification, error) {
+	query := `
+		SELECT id , user_id , actor_id , type , post_id , comment_id , read_at , created_at
+		FROM notifications WHERE user_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.ActorID,
+			&n.Type,
+			&n.PostID,
+			&n.CommentID,
+			&n.ReadAt,
+			&n.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *ExportStorage) messages(ctx context.Context, userID int64) ([]Message, error) {
+	query := `
+		SELECT m.id , m.conversation_id , m.sender_id , m.content , m.created_at
+		FROM messages m
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id
+		WHERE cm.user_id = $1
+		ORDER BY m.conversation_id , m.id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *ExportStorage) media(ctx context.Context, userID int64) ([]Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE user_id = $1 ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		if err := scanMedia(rows, &m); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+func (s *ExportStorage) pollVotes(ctx context.Context, userID int64) ([]ExportPollVote, error) {
+	query := `
+		SELECT p.id , p.post_id , o.id , o.text , pv.created_at
+		FROM poll_votes v
+		JOIN poll_voters pv ON pv.poll_id = v.poll_id AND pv.user_id = v.user_id
+		JOIN polls p ON p.id = v.poll_id
+		JOIN poll_options o ON o.id = v.option_id
+		WHERE v.user_id = $1
+		ORDER BY pv.created_at , o.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	votes := []ExportPollVote{}
+	for rows.Next() {
+		var v ExportPollVote
+		if err := rows.Scan(&v.PollID, &v.PostID, &v.OptionID, &v.Option, &v.VotedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
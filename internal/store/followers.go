@@ -16,6 +16,20 @@ type Follower struct {
 	UpdatedAt  string `json:"updated_at"`
 }
 
+// 推荐关注的用户
+type Suggestion struct {
+	User        User `json:"user"`
+	MutualCount int  `json:"mutual_count"` //共同关注的人数
+	TagOverlap  int  `json:"tag_overlap"`  //标签重合的数量
+	Score       int  `json:"score"`
+}
+
+// 推荐打分的权重
+const (
+	suggestionMutualWeight = 3
+	suggestionTagWeight    = 1
+)
+
 // follower的存储
 type FollowerStorage struct {
 	db *sql.DB
@@ -26,16 +40,19 @@ func (s *FollowerStorage) Follow(ctx context.Context, followerID int64, userID i
 	query := `
 		INSERT INTO followers (user_id , follower_id) VALUES ($1,$2)
 	`
-	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
-	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
-	//错误处理
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrConflict
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		_, err := tx.ExecContext(ctx, query, userID, followerID)
+		//错误处理
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
 		}
-	}
-	return nil
+		return addEvent(ctx, tx, EventUserFollowed, UserFollowed{FollowerID: followerID, UserID: userID})
+	})
 }
 
 // Unfollow的实现
@@ -55,3 +72,89 @@ func (s *FollowerStorage) Unfollow(ctx context.Context, followerID int64, userID
 	return nil
 
 }
+
+// 用户关注的人的ID
+func (s *FollowerStorage) FollowingIDs(ctx context.Context, followerID int64) ([]int64, error) {
+	query := `SELECT user_id FROM followers WHERE follower_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, followerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 推荐关注:朋友的朋友按共同关注数加权,再加上与用户参与过的帖子的标签重合度
+func (s *FollowerStorage) Suggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+		WITH following AS (
+			SELECT user_id FROM followers WHERE follower_id = $1
+		),
+		engaged_tags AS (
+			SELECT DISTINCT unnest(p.tags) AS tag
+			FROM posts p
+			WHERE p.deleted_at IS NULL
+				AND (p.user_id = $1 OR p.id IN (SELECT post_id FROM comments WHERE user_id = $1 AND deleted_at IS NULL))
+		),
+		mutuals AS (
+			SELECT f.user_id AS candidate_id, COUNT(DISTINCT f.follower_id) AS mutual_count
+			FROM followers f
+			WHERE f.follower_id IN (SELECT user_id FROM following)
+			GROUP BY f.user_id
+		),
+		tag_overlap AS (
+			SELECT p.user_id AS candidate_id, COUNT(DISTINCT t.tag) AS tag_overlap
+			FROM posts p, unnest(p.tags) AS t(tag)
+			WHERE p.status = 'published' AND p.deleted_at IS NULL AND p.visibility = 'public'
+				AND t.tag IN (SELECT tag FROM engaged_tags)
+			GROUP BY p.user_id
+		)
+		SELECT
+			u.id,
+			u.username,
+			COALESCE(m.mutual_count, 0) AS mutual_count,
+			COALESCE(t.tag_overlap, 0) AS tag_overlap
+		FROM users u
+		LEFT JOIN mutuals m ON m.candidate_id = u.id
+		LEFT JOIN tag_overlap t ON t.candidate_id = u.id
+		WHERE (m.candidate_id IS NOT NULL OR t.candidate_id IS NOT NULL)
+			AND u.id <> $1
+			AND u.is_active = true
+			AND u.id NOT IN (SELECT user_id FROM following)
+		ORDER BY COALESCE(m.mutual_count, 0) * $2 + COALESCE(t.tag_overlap, 0) * $3 DESC, u.id
+		LIMIT $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, suggestionMutualWeight, suggestionTagWeight, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var sg Suggestion
+		err := rows.Scan(
+			&sg.User.ID,
+			&sg.User.Username,
+			&sg.MutualCount,
+			&sg.TagOverlap,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sg.Score = sg.MutualCount*suggestionMutualWeight + sg.TagOverlap*suggestionTagWeight
+		suggestions = append(suggestions, sg)
+	}
+	return suggestions, rows.Err()
+}
@@ -0,0 +1,320 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidAttachment = errors.New("attachments must be your own unattached uploads")
+
+// 媒体文件的处理状态,图片上传后由后台处理,其他类型直接就绪
+const (
+	MediaPending    = "pending"
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+// 上传的媒体文件
+type Media struct {
+	ID           int64   `json:"id"`
+	UserID       int64   `json:"user_id"`
+	PostID       *int64  `json:"post_id"`
+	StorageKey   string  `json:"-"`
+	MimeType     string  `json:"mime_type"`
+	Size         int64   `json:"size"`
+	Status       string  `json:"status"`
+	Width        *int    `json:"width"`
+	Height       *int    `json:"height"`
+	Blurhash     *string `json:"blurhash"`
+	ThumbnailKey *string `json:"-"`
+	MediumKey    *string `json:"-"`
+	CreatedAt    string  `json:"created_at"`
+	//访问地址,由API层填充
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	MediumURL    string `json:"medium_url,omitempty"`
+}
+
+const mediaColumns = `id , user_id , post_id , storage_key , mime_type , size_bytes , status ,
+		width , height , blurhash , thumbnail_key , medium_key , created_at`
+
+// 按mediaColumns的顺序扫描
+func scanMedia(row interface{ Scan(...any) error }, m *Media) error {
+	return row.Scan(
+		&m.ID,
+		&m.UserID,
+		&m.PostID,
+		&m.StorageKey,
+		&m.MimeType,
+		&m.Size,
+		&m.Status,
+		&m.Width,
+		&m.Height,
+		&m.Blurhash,
+		&m.ThumbnailKey,
+		&m.MediumKey,
+		&m.CreatedAt,
+	)
+}
+
+// Media的存储
+type MediaStore struct {
+	db *sql.DB
+}
+
+// 记录上传的文件
+func (s *MediaStore) Create(ctx context.Context, media *Media) error {
+	query := `
+		INSERT INTO media (user_id , storage_key , mime_type , size_bytes , status)
+		VALUES ($1,$2,$3,$4,$5) RETURNING id , created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		media.UserID,
+		media.StorageKey,
+		media.MimeType,
+		media.Size,
+		media.Status,
+	).Scan(
+		&media.ID,
+		&media.CreatedAt,
+	)
+}
+
+// 通过ID得到媒体文件
+func (s *MediaStore) GetByID(ctx context.Context, mediaID int64) (*Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	media := &Media{}
+	err := scanMedia(s.db.QueryRowContext(ctx, query, mediaID), media)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// 得到这些帖子的附件
+func (s *MediaStore) GetByPostIDs(ctx context.Context, postIDs []int64) ([]Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media WHERE post_id = ANY($1)
+		ORDER BY post_id , id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		err := scanMedia(rows, &m)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+// 把用户自己还没有使用过的上传挂到帖子上,有任何一个不满足条件都会失败
+func attachMedia(ctx context.Context, tx *sql.Tx, postID int64, userID int64, mediaIDs []int64) ([]Media, error) {
+	if len(mediaIDs) == 0 {
+		return []Media{}, nil
+	}
+	query := `
+		UPDATE media SET post_id = $1
+		WHERE id = ANY($2) AND user_id = $3 AND post_id IS NULL AND status <> 'failed'
+		RETURNING ` + mediaColumns + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, postID, pq.Array(mediaIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		err := scanMedia(rows, &m)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(media) != len(mediaIDs) {
+		return nil, ErrInvalidAttachment
+	}
+	return media, nil
+}
+
+// 认领一个待处理的文件,状态不是pending时返回ErrNotFound,保证只被处理一次
+func (s *MediaStore) ClaimForProcessing(ctx context.Context, mediaID int64) (*Media, error) {
+	query := `
+		UPDATE media SET status = 'processing' , updated_at = now()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + mediaColumns + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	media := &Media{}
+	err := scanMedia(s.db.QueryRowContext(ctx, query, mediaID), media)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// 保存处理的结果
+func (s *MediaStore) CompleteProcessing(ctx context.Context, media *Media) error {
+	query := `
+		UPDATE media
+		SET status = 'ready' , mime_type = $2 , size_bytes = $3 , width = $4 , height = $5 ,
+			blurhash = $6 , thumbnail_key = $7 , medium_key = $8 , updated_at = now()
+		WHERE id = $1 AND status = 'processing'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(
+		ctx,
+		query,
+		media.ID,
+		media.MimeType,
+		media.Size,
+		media.Width,
+		media.Height,
+		media.Blurhash,
+		media.ThumbnailKey,
+		media.MediumKey,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	media.Status = MediaReady
+	return nil
+}
+
+// 标记处理失败
+func (s *MediaStore) FailProcessing(ctx context.Context, mediaID int64) error {
+	query := `UPDATE media SET status = 'failed' , updated_at = now() WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, mediaID)
+	return err
+}
+
+// 把超过一段时间还没有处理完的文件重新放回pending,返回它们的ID
+// 覆盖了队列满时没能入队的,以及处理过程中进程退出的
+func (s *MediaStore) RequeueStalled(ctx context.Context, before time.Time) ([]int64, error) {
+	query := `
+		UPDATE media SET status = 'pending' , updated_at = now()
+		WHERE status IN ('pending', 'processing') AND updated_at < $1
+		RETURNING id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 删除满足condition的媒体记录,同时把原文件和处理后的版本放入blob_deletions
+// 帖子和用户删除时会级联删除媒体记录,所以要在删除帖子和用户之前调用
+func deleteMedia(ctx context.Context, tx *sql.Tx, condition string, args ...any) error {
+	query := `
+		WITH deleted AS (
+			DELETE FROM media WHERE ` + condition + `
+			RETURNING storage_key , thumbnail_key , medium_key
+		)
+		INSERT INTO blob_deletions (key)
+		SELECT k FROM deleted , unnest(ARRAY[storage_key , thumbnail_key , medium_key]) AS k
+		WHERE k IS NOT NULL
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// 删除before之前上传但一直没有挂到帖子上的文件
+func (s *MediaStore) PurgeUnattached(ctx context.Context, before time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return deleteMedia(ctx, tx, `post_id IS NULL AND created_at < $1`, before)
+	})
+}
+
+// 等待从blob存储中删除的文件
+func (s *MediaStore) GetBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	query := `SELECT key FROM blob_deletions ORDER BY created_at LIMIT $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// 文件已经从blob存储中删除
+func (s *MediaStore) RemoveBlobDeletions(ctx context.Context, keys []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM blob_deletions WHERE key = ANY($1)`, pq.Array(keys))
+	return err
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// @username提及的模型,Start和End是在content中以rune计算的偏移量[Start,End)
+type Mention struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	AuthorID  int64  `json:"author_id"`
+	PostID    int64  `json:"post_id"`
+	CommentID *int64 `json:"comment_id"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	CreatedAt string `json:"created_at"`
+}
+
+// 被提及时的上下文
+type MentionWithContext struct {
+	Mention
+	Author    User   `json:"author"`
+	PostTitle string `json:"post_title"`
+	Content   string `json:"content"`
+}
+
+// Mention的存储
+type MentionStore struct {
+	db *sql.DB
+}
+
+// 从文本中解析出@username,不查询数据库
+func ParseMentions(content string) []Mention {
+	runes := []rune(content)
+	mentions := []Mention{}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' {
+			continue
+		}
+		//类似a@b.com的邮件地址不算提及
+		if i > 0 && isMentionRune(runes[i-1]) {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && isMentionRune(runes[j]) {
+			j++
+		}
+		if j == i+1 {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Username: string(runes[i+1 : j]),
+			Start:    i,
+			End:      j,
+		})
+		i = j - 1
+	}
+	return mentions
+}
+
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// 解析content中的提及并写入mentions表,不存在的用户会被忽略
+func saveMentions(ctx context.Context, tx *sql.Tx, authorID int64, postID int64, commentID *int64, content string) ([]Mention, error) {
+	parsed := ParseMentions(content)
+	if len(parsed) == 0 {
+		return []Mention{}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	//查询被提及的用户
+	usernames := make([]string, 0, len(parsed))
+	for _, m := range parsed {
+		usernames = append(usernames, m.Username)
+	}
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id , username FROM users WHERE username = ANY($1) AND is_active = true`,
+		pq.Array(usernames),
+	)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids[username] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	//写入mentions表
+	query := `
+		INSERT INTO mentions (user_id , author_id , post_id , comment_id , start_offset , end_offset)
+		VALUES ($1,$2,$3,$4,$5,$6) RETURNING id , created_at
+	`
+	mentions := []Mention{}
+	for _, m := range parsed {
+		userID, ok := ids[m.Username]
+		if !ok {
+			continue
+		}
+		m.UserID = userID
+		m.AuthorID = authorID
+		m.PostID = postID
+		m.CommentID = commentID
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			m.UserID,
+			m.AuthorID,
+			m.PostID,
+			m.CommentID,
+			m.Start,
+			m.End,
+		).Scan(
+			&m.ID,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, nil
+}
+
+// 删除帖子正文中的提及(不包括评论中的)
+func deletePostMentions(ctx context.Context, tx *sql.Tx, postID int64) error {
+	query := `DELETE FROM mentions WHERE post_id = $1 AND comment_id IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, postID)
+	return err
+}
+
+// 得到这些帖子以及其评论中的全部提及
+func (s *MentionStore) GetByPostIDs(ctx context.Context, postIDs []int64) ([]Mention, error) {
+	query := `
+		SELECT m.id , m.user_id , u.username , m.author_id , m.post_id , m.comment_id ,
+			m.start_offset , m.end_offset , m.created_at
+		FROM mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.post_id = ANY($1)
+		ORDER BY m.post_id , m.comment_id NULLS FIRST , m.start_offset
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mentions := []Mention{}
+	for rows.Next() {
+		var m Mention
+		err := rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.Username,
+			&m.AuthorID,
+			&m.PostID,
+			&m.CommentID,
+			&m.Start,
+			&m.End,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// 得到提及某个用户的记录
+func (s *MentionStore) GetByUserID(ctx context.Context, userID int64, fq PaginationFeedQuery) ([]MentionWithContext, error) {
+	query := `
+		SELECT m.id , m.user_id , mu.username , m.author_id , m.post_id , m.comment_id ,
+			m.start_offset , m.end_offset , m.created_at ,
+			a.id , a.username , p.title , COALESCE(c.content, p.content)
+		FROM mentions m
+		JOIN users mu ON mu.id = m.user_id
+		JOIN users a ON a.id = m.author_id
+		JOIN posts p ON p.id = m.post_id
+		LEFT JOIN comments c ON c.id = m.comment_id
+		WHERE m.user_id = $1 AND p.status = 'published' AND p.deleted_at IS NULL AND c.deleted_at IS NULL
+			AND ` + visibleTo("p", "$1") + `
+		ORDER BY m.created_at ` + fq.Sort + ` , m.id
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mentions := []MentionWithContext{}
+	for rows.Next() {
+		var m MentionWithContext
+		err := rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.Username,
+			&m.AuthorID,
+			&m.PostID,
+			&m.CommentID,
+			&m.Start,
+			&m.End,
+			&m.CreatedAt,
+			&m.Author.ID,
+			&m.Author.Username,
+			&m.PostTitle,
+			&m.Content,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
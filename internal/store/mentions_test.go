@@ -0,0 +1,46 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	type span struct {
+		username   string
+		start, end int
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []span
+	}{
+		{"empty", "", nil},
+		{"single", "hi @alice", []span{{"alice", 3, 9}}},
+		{"start of text", "@bob hello", []span{{"bob", 0, 4}}},
+		{"multiple", "@a and @b_2!", []span{{"a", 0, 2}, {"b_2", 7, 11}}},
+		{"email address", "mail a@b.com", nil},
+		{"bare at", "@ and @@", nil},
+		{"rune offsets", "你好 @小明 和 @bob", []span{{"小明", 3, 6}, {"bob", 9, 13}}},
+		{"emoji before", "👋👋 @alice", []span{{"alice", 3, 9}}},
+		{"hyphen ends name", "@alice-smith", []span{{"alice", 0, 6}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []span
+			for _, m := range ParseMentions(tt.content) {
+				got = append(got, span{m.Username, m.Start, m.End})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+			//偏移量对应的文字就是@username
+			runes := []rune(tt.content)
+			for _, s := range got {
+				if text := string(runes[s.start:s.end]); text != "@"+s.username {
+					t.Errorf("content[%d:%d] = %q, want %q", s.start, s.end, text, "@"+s.username)
+				}
+			}
+		})
+	}
+}
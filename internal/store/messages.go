@@ -0,0 +1,442 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// 谁可以给用户发私信
+const (
+	DMPolicyEveryone  = "everyone"
+	DMPolicyFollowing = "following" //只接受自己关注的人
+)
+
+// 会话最多的成员数,包括创建者
+const MaxConversationMembers = 10
+
+var (
+	ErrDMNotAllowed        = errors.New("user only accepts messages from people they follow")
+	ErrInvalidConversation = fmt.Errorf("a conversation needs between 2 and %d members", MaxConversationMembers)
+)
+
+// 私信会话,两个人的是一对一会话,否则是群组
+type Conversation struct {
+	ID            int64                `json:"id"`
+	IsGroup       bool                 `json:"is_group"`
+	Title         *string              `json:"title"`
+	CreatedBy     *int64               `json:"created_by"`
+	CreatedAt     string               `json:"created_at"`
+	LastMessageAt string               `json:"last_message_at"`
+	Members       []ConversationMember `json:"members"`
+	LastMessage   *Message             `json:"last_message"`
+	//当前用户的未读数
+	UnreadCount int `json:"unread_count"`
+}
+
+// 会话成员,LastReadMessageID用作已读回执
+type ConversationMember struct {
+	UserID            int64  `json:"user_id"`
+	Username          string `json:"username"`
+	LastReadMessageID int64  `json:"last_read_message_id"`
+}
+
+// 私信
+type Message struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	SenderID       int64  `json:"sender_id"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// 私信的存储
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// 创建会话,memberIDs不包括创建者
+// 一对一会话已经存在时返回已有的会话,created为false
+func (s *ConversationStore) Create(ctx context.Context, creatorID int64, memberIDs []int64, title *string) (conv *Conversation, created bool, err error) {
+	members := []int64{creatorID}
+	seen := map[int64]bool{creatorID: true}
+	for _, id := range memberIDs {
+		if !seen[id] {
+			seen[id] = true
+			members = append(members, id)
+		}
+	}
+	if len(members) < 2 || len(members) > MaxConversationMembers {
+		return nil, false, ErrInvalidConversation
+	}
+	var convID int64
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		//成员必须是已经激活的用户
+		var count int
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*) FROM users WHERE id = ANY($1) AND is_active`,
+			pq.Array(members),
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count != len(members) {
+			return ErrNotFound
+		}
+		if err := checkDMPolicy(ctx, tx, creatorID, members[1:]); err != nil {
+			return err
+		}
+		if len(members) == 2 {
+			a, b := members[0], members[1]
+			if a > b {
+				a, b = b, a
+			}
+			key := fmt.Sprintf("%d:%d", a, b)
+			err := tx.QueryRowContext(
+				ctx,
+				`INSERT INTO conversations (created_by , is_group , direct_key) VALUES ($1 , false , $2)
+				ON CONFLICT (direct_key) DO NOTHING RETURNING id`,
+				creatorID,
+				key,
+			).Scan(&convID)
+			if errors.Is(err, sql.ErrNoRows) {
+				//已经存在,成员也已经存在
+				return tx.QueryRowContext(ctx, `SELECT id FROM conversations WHERE direct_key = $1`, key).Scan(&convID)
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			err := tx.QueryRowContext(
+				ctx,
+				`INSERT INTO conversations (created_by , is_group , title) VALUES ($1 , true , $2) RETURNING id`,
+				creatorID,
+				title,
+			).Scan(&convID)
+			if err != nil {
+				return err
+			}
+		}
+		created = true
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO conversation_members (conversation_id , user_id) SELECT $1 , unnest($2::bigint[])`,
+			convID,
+			pq.Array(members),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	conv, err = s.GetByID(ctx, convID, creatorID)
+	return conv, created, err
+}
+
+// 检查recipients是否接受senderID的私信
+func checkDMPolicy(ctx context.Context, tx *sql.Tx, senderID int64, recipients []int64) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM users u
+			WHERE u.id = ANY($1) AND u.id <> $2 AND u.dm_policy = 'following' AND NOT EXISTS (
+				SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = u.id)
+		)
+	`
+	var denied bool
+	if err := tx.QueryRowContext(ctx, query, pq.Array(recipients), senderID).Scan(&denied); err != nil {
+		return err
+	}
+	if denied {
+		return ErrDMNotAllowed
+	}
+	return nil
+}
+
+// 得到用户所在的会话,不是成员时返回ErrNotFound
+func (s *ConversationStore) GetByID(ctx context.Context, convID int64, userID int64) (*Conversation, error) {
+	convs, err := s.list(ctx, userID, convID, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &convs[0], nil
+}
+
+// 用户的会话,按最后一条消息的时间倒序
+// 传入cursor时从游标之后开始,返回下一页的cursor,没有下一页时为空
+func (s *ConversationStore) GetByUserID(ctx context.Context, userID int64, cursor string, limit int) ([]Conversation, string, error) {
+	var after *PostCursor
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+	convs, err := s.list(ctx, userID, 0, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	//这一页满了才有下一页
+	next := ""
+	if len(convs) == limit {
+		last := convs[len(convs)-1]
+		next = EncodeCursor(last.LastMessageAt, last.ID)
+	}
+	return convs, next, nil
+}
+
+// convID不为0时只查这一个会话,after不为nil时从(last_message_at , id)之后开始
+func (s *ConversationStore) list(ctx context.Context, userID int64, convID int64, after *PostCursor, limit int) ([]Conversation, error) {
+	query := `
+		SELECT c.id , c.is_group , c.title , c.created_by , c.created_at , c.last_message_at ,
+			(SELECT COUNT(*) FROM messages m
+			 WHERE m.conversation_id = c.id AND m.id > cm.last_read_message_id AND m.sender_id <> cm.user_id) ,
+			lm.id , lm.sender_id , lm.content , lm.created_at
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id AND cm.user_id = $1
+		LEFT JOIN LATERAL (
+			SELECT id , sender_id , content , created_at FROM messages
+			WHERE conversation_id = c.id ORDER BY id DESC LIMIT 1
+		) lm ON true
+		WHERE ($2 = 0 OR c.id = $2) AND
+			($4::timestamptz IS NULL OR (c.last_message_at , c.id) < ($4::timestamptz , $5::bigint))
+		ORDER BY c.last_message_at DESC , c.id DESC
+		LIMIT $3
+	`
+	var (
+		afterAt *string
+		afterID int64
+	)
+	if after != nil {
+		afterAt, afterID = &after.CreatedAt, after.ID
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, convID, limit, afterAt, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	convs := []Conversation{}
+	for rows.Next() {
+		var (
+			c         Conversation
+			msgID     *int64
+			senderID  *int64
+			content   *string
+			createdAt *string
+		)
+		err := rows.Scan(
+			&c.ID,
+			&c.IsGroup,
+			&c.Title,
+			&c.CreatedBy,
+			&c.CreatedAt,
+			&c.LastMessageAt,
+			&c.UnreadCount,
+			&msgID,
+			&senderID,
+			&content,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if msgID != nil {
+			c.LastMessage = &Message{
+				ID:             *msgID,
+				ConversationID: c.ID,
+				SenderID:       *senderID,
+				Content:        *content,
+				CreatedAt:      *createdAt,
+			}
+		}
+		c.Members = []ConversationMember{}
+		convs = append(convs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return convs, nil
+	}
+	//成员和已读位置
+	ids := make([]int64, 0, len(convs))
+	byID := make(map[int64]*Conversation, len(convs))
+	for i := range convs {
+		ids = append(ids, convs[i].ID)
+		byID[convs[i].ID] = &convs[i]
+	}
+	rows, err = s.db.QueryContext(
+		ctx,
+		`SELECT cm.conversation_id , u.id , u.username , cm.last_read_message_id
+		FROM conversation_members cm JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1)
+		ORDER BY cm.joined_at , u.id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			convID int64
+			m      ConversationMember
+		)
+		if err := rows.Scan(&convID, &m.UserID, &m.Username, &m.LastReadMessageID); err != nil {
+			return nil, err
+		}
+		byID[convID].Members = append(byID[convID].Members, m)
+	}
+	return convs, rows.Err()
+}
+
+// 会话所有成员的ID
+func (s *ConversationStore) MemberIDs(ctx context.Context, convID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM conversation_members WHERE conversation_id = $1`, convID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 发送消息,每次发送都检查其他成员的私信设置
+// 群组也一样,只接受关注的人私信的成员不会通过群组收到陌生人的消息
+func (s *ConversationStore) Send(ctx context.Context, msg *Message) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		var isMember bool
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)`,
+			msg.ConversationID,
+			msg.SenderID,
+		).Scan(&isMember)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return ErrNotFound
+		}
+		var recipients []int64
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT COALESCE(array_agg(user_id) , '{}') FROM conversation_members WHERE conversation_id = $1 AND user_id <> $2`,
+			msg.ConversationID,
+			msg.SenderID,
+		).Scan(pq.Array(&recipients))
+		if err != nil {
+			return err
+		}
+		if err := checkDMPolicy(ctx, tx, msg.SenderID, recipients); err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(
+			ctx,
+			`INSERT INTO messages (conversation_id , sender_id , content) VALUES ($1,$2,$3) RETURNING id , created_at`,
+			msg.ConversationID,
+			msg.SenderID,
+			msg.Content,
+		).Scan(&msg.ID, &msg.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE conversations SET last_message_at = now() WHERE id = $1`, msg.ConversationID); err != nil {
+			return err
+		}
+		//自己发的消息视为已读
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE conversation_members SET last_read_message_id = $3 WHERE conversation_id = $1 AND user_id = $2`,
+			msg.ConversationID,
+			msg.SenderID,
+			msg.ID,
+		)
+		return err
+	})
+}
+
+// 会话中的消息,按ID倒序,before为0时从最新的开始
+func (s *ConversationStore) GetMessages(ctx context.Context, convID int64, userID int64, before int64, limit int) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	var member bool
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)`,
+		convID,
+		userID,
+	).Scan(&member)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrNotFound
+	}
+	query := `
+		SELECT id , conversation_id , sender_id , content , created_at
+		FROM messages
+		WHERE conversation_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, convID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// 已读回执,已读位置只会前进
+func (s *ConversationStore) MarkRead(ctx context.Context, convID int64, userID int64, messageID int64) error {
+	query := `
+		UPDATE conversation_members SET last_read_message_id = GREATEST(last_read_message_id , $3)
+		WHERE conversation_id = $1 AND user_id = $2 AND EXISTS (
+			SELECT 1 FROM messages WHERE id = $3 AND conversation_id = $1)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, convID, userID, messageID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
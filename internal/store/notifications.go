@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// 通知的类型
+const (
+	NotificationFollow  = "follow"
+	NotificationComment = "comment"
+	NotificationMention = "mention"
+)
+
+// 一条通知,UserID是接收者,ActorID是触发的人
+type Notification struct {
+	ID        int64   `json:"id"`
+	UserID    int64   `json:"user_id"`
+	ActorID   int64   `json:"actor_id"`
+	Type      string  `json:"type"`
+	PostID    *int64  `json:"post_id"`
+	CommentID *int64  `json:"comment_id"`
+	ReadAt    *string `json:"read_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// 同一个类型,同一个帖子,同样已读状态的通知合并成一组
+type NotificationGroup struct {
+	//组内最新的通知ID,也用作游标
+	ID         int64   `json:"id"`
+	Type       string  `json:"type"`
+	PostID     *int64  `json:"post_id"`
+	Read       bool    `json:"read"`
+	Count      int     `json:"count"`
+	ActorCount int     `json:"actor_count"`
+	Actors     []Actor `json:"actors"`
+	//组内所有通知的ID,标记已读时使用
+	NotificationIDs []int64 `json:"notification_ids"`
+	LatestAt        string  `json:"latest_at"`
+}
+
+// 触发通知的人
+type Actor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// 每组最多返回的触发者
+const maxGroupActors = 3
+
+// Notification的存储
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// 批量写入通知,忽略自己触发的,接收者看不到帖子的,以及重复的关注和提及
+// 返回实际写入的通知
+func (s *NotificationStore) Create(ctx context.Context, notifications []Notification) ([]Notification, error) {
+	if len(notifications) == 0 {
+		return []Notification{}, nil
+	}
+	var (
+		userIDs    = make([]int64, 0, len(notifications))
+		actorIDs   = make([]int64, 0, len(notifications))
+		types      = make([]string, 0, len(notifications))
+		postIDs    = make([]int64, 0, len(notifications))
+		commentIDs = make([]int64, 0, len(notifications))
+	)
+	for _, n := range notifications {
+		userIDs = append(userIDs, n.UserID)
+		actorIDs = append(actorIDs, n.ActorID)
+		types = append(types, n.Type)
+		postIDs = append(postIDs, derefID(n.PostID))
+		commentIDs = append(commentIDs, derefID(n.CommentID))
+	}
+	query := `
+		INSERT INTO notifications (user_id , actor_id , type , post_id , comment_id)
+		SELECT n.user_id , n.actor_id , n.type , NULLIF(n.post_id , 0) , NULLIF(n.comment_id , 0)
+		FROM unnest($1::bigint[] , $2::bigint[] , $3::varchar[] , $4::bigint[] , $5::bigint[])
+			AS n(user_id , actor_id , type , post_id , comment_id)
+		WHERE n.user_id <> n.actor_id AND (n.post_id = 0 OR EXISTS (
+			SELECT 1 FROM posts p
+			WHERE p.id = n.post_id AND p.status = 'published' AND p.deleted_at IS NULL AND
+				` + visibleTo("p", "n.user_id") + `))
+		ON CONFLICT DO NOTHING
+		RETURNING id , user_id , actor_id , type , post_id , comment_id , created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		pq.Array(userIDs),
+		pq.Array(actorIDs),
+		pq.Array(types),
+		pq.Array(postIDs),
+		pq.Array(commentIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	created := []Notification{}
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.ActorID,
+			&n.Type,
+			&n.PostID,
+			&n.CommentID,
+			&n.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, n)
+	}
+	return created, rows.Err()
+}
+
+// 分组得到用户的通知,按组内最新的通知倒序,before为0时从最新的开始
+func (s *NotificationStore) GetGroups(ctx context.Context, userID int64, before int64, limit int) ([]NotificationGroup, error) {
+	query := `
+		SELECT MAX(n.id) AS latest_id , n.type , n.post_id , n.read_at IS NOT NULL ,
+			COUNT(*) , COUNT(DISTINCT n.actor_id) , MAX(n.created_at) ,
+			array_agg(n.id ORDER BY n.id DESC) ,
+			array_agg(n.actor_id ORDER BY n.id DESC) ,
+			array_agg(u.username ORDER BY n.id DESC)
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		LEFT JOIN posts p ON p.id = n.post_id
+		WHERE n.user_id = $1 AND (n.post_id IS NULL OR p.deleted_at IS NULL)
+		GROUP BY n.type , n.post_id , n.read_at IS NOT NULL
+		HAVING $2 = 0 OR MAX(n.id) < $2
+		ORDER BY latest_id DESC
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := []NotificationGroup{}
+	for rows.Next() {
+		var (
+			g         NotificationGroup
+			actorIDs  []int64
+			usernames []string
+		)
+		err := rows.Scan(
+			&g.ID,
+			&g.Type,
+			&g.PostID,
+			&g.Read,
+			&g.Count,
+			&g.ActorCount,
+			&g.LatestAt,
+			pq.Array(&g.NotificationIDs),
+			pq.Array(&actorIDs),
+			pq.Array(&usernames),
+		)
+		if err != nil {
+			return nil, err
+		}
+		g.Actors = latestActors(actorIDs, usernames)
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// 未读通知的数量,和GetGroups一样不计算已经删除的帖子上的通知
+func (s *NotificationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM notifications n
+		LEFT JOIN posts p ON p.id = n.post_id
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND (n.post_id IS NULL OR p.deleted_at IS NULL)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// 标记已读,ids为空时标记全部
+func (s *NotificationStore) MarkRead(ctx context.Context, userID int64, ids []int64) error {
+	query := `
+		UPDATE notifications SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::bigint[]) = 0 OR id = ANY($2))
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	if ids == nil {
+		ids = []int64{}
+	}
+	_, err := s.db.ExecContext(ctx, query, userID, pq.Array(ids))
+	return err
+}
+
+// 最近的几个不同的触发者,ids按时间倒序
+func latestActors(ids []int64, usernames []string) []Actor {
+	actors := []Actor{}
+	seen := map[int64]bool{}
+	for i, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		actors = append(actors, Actor{ID: id, Username: usernames[i]})
+		if len(actors) == maxGroupActors {
+			break
+		}
+	}
+	return actors
+}
+
+func derefID(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLatestActors(t *testing.T) {
+	tests := []struct {
+		name      string
+		ids       []int64
+		usernames []string
+		want      []Actor
+	}{
+		{"empty", nil, nil, []Actor{}},
+		{"distinct", []int64{3, 2}, []string{"c", "b"}, []Actor{{3, "c"}, {2, "b"}}},
+		{"repeated actor", []int64{3, 2, 3, 1}, []string{"c", "b", "c", "a"}, []Actor{{3, "c"}, {2, "b"}, {1, "a"}}},
+		{"capped", []int64{5, 4, 3, 2, 1}, []string{"e", "d", "c", "b", "a"}, []Actor{{5, "e"}, {4, "d"}, {3, "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestActors(tt.ids, tt.usernames); !slices.Equal(got, tt.want) {
+				t.Errorf("latestActors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 领域事件的类型
+const (
+	EventUserRegistered = "UserRegistered"
+	//直接发布,草稿发布和定时发布都会产生
+	EventPostCreated = "PostCreated"
+	//已经发布的帖子被编辑
+	EventPostUpdated    = "PostUpdated"
+	EventUserFollowed   = "UserFollowed"
+	EventCommentCreated = "CommentCreated"
+	//申请导出个人数据
+	EventExportRequested = "ExportRequested"
+)
+
+// 用户注册
+type UserRegistered struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// 帖子发布或者编辑
+type PostEvent struct {
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+}
+
+// 关注
+type UserFollowed struct {
+	FollowerID int64 `json:"follower_id"`
+	UserID     int64 `json:"user_id"`
+}
+
+// 评论
+type CommentCreated struct {
+	CommentID int64 `json:"comment_id"`
+	PostID    int64 `json:"post_id"`
+	UserID    int64 `json:"user_id"`
+}
+
+// 申请导出个人数据
+type ExportRequested struct {
+	UserID int64 `json:"user_id"`
+}
+
+// 发件箱中的事件
+type OutboxEvent struct {
+	ID        int64
+	Type      string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+	//已经处理成功的handler
+	Handled []string
+	//以下由分发者在记录结果时设置
+	Processed     bool
+	Failed        bool
+	NextAttemptAt time.Time
+	LastError     *string
+}
+
+// 在状态变化的事务中写入事件,事务提交之后事件才可见
+func addEvent(ctx context.Context, tx *sql.Tx, typ string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, `INSERT INTO outbox_events (type , payload) VALUES ($1,$2)`, typ, string(data))
+	return err
+}
+
+// 发件箱的存储
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// 领取到期的事件,领取的事件在lease之内不会被其他实例领取
+func (s *OutboxStore) ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	query := `
+		UPDATE outbox_events SET next_attempt_at = now() + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE processed_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id , type , payload , attempts , handled , created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, lease.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []OutboxEvent{}
+	for rows.Next() {
+		var ev OutboxEvent
+		err := rows.Scan(
+			&ev.ID,
+			&ev.Type,
+			&ev.Payload,
+			&ev.Attempts,
+			pq.Array(&ev.Handled),
+			&ev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// 记录一次分发的结果
+func (s *OutboxStore) RecordAttempt(ctx context.Context, ev *OutboxEvent) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1 , handled = $2 , next_attempt_at = $3 , last_error = $4 ,
+			processed_at = CASE WHEN $5 THEN now() END ,
+			failed_at = CASE WHEN $6 THEN now() END
+		WHERE id = $1
+		RETURNING attempts
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	if ev.Handled == nil {
+		ev.Handled = []string{}
+	}
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		ev.ID,
+		pq.Array(ev.Handled),
+		ev.NextAttemptAt,
+		ev.LastError,
+		ev.Processed,
+		ev.Failed,
+	).Scan(&ev.Attempts)
+}
+
+// 删除before之前处理完的事件
+func (s *OutboxStore) Purge(ctx context.Context, before time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE processed_at < $1`, before)
+	return err
+}
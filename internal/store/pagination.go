@@ -1,12 +1,16 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type PaginationFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
@@ -15,6 +19,7 @@ type PaginationFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Util   string   `json:"util"`
+	Cursor string   `json:"cursor" validate:"max=200"`
 }
 
 func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error) {
@@ -47,6 +52,10 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 	tags := qs.Get("tags")
 	if tags != "" {
 		fq.Tags = strings.Split(tags, ",")
+		//和写入时保持一致的规范化
+		for i, tag := range fq.Tags {
+			fq.Tags[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		}
 	}
 	//读取Search
 	search := qs.Get("search")
@@ -58,9 +67,45 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 	if since != "" {
 		fq.Since = parseTime(since)
 	}
+	//游标分页
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
 	return fq, nil
 }
 
+// 游标,指向上一页最后一个帖子
+type PostCursor struct {
+	CreatedAt string
+	ID        int64
+}
+
+// 编码游标,对客户端是不透明的
+func EncodeCursor(createdAt string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt + "|" + strconv.FormatInt(id, 10)))
+}
+
+// 解码游标
+func DecodeCursor(s string) (PostCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	return PostCursor{CreatedAt: createdAt, ID: n}, nil
+}
+
 // 解析时间的API
 func parseTime(s string) string {
 	t, err := time.Parse(time.DateTime, s)
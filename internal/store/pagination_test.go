@@ -0,0 +1,48 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		createdAt string
+		id        int64
+	}{
+		{"2024-05-01T10:00:00Z", 1},
+		{"2024-05-01T10:00:00.123456+08:00", 9007199254740993},
+	} {
+		c, err := DecodeCursor(EncodeCursor(tt.createdAt, tt.id))
+		if err != nil {
+			t.Fatalf("DecodeCursor: %v", err)
+		}
+		if c.CreatedAt != tt.createdAt || c.ID != tt.id {
+			t.Errorf("cursor = %+v, want %s %d", c, tt.createdAt, tt.id)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2024-05-01T10:00:00Z|1"))},
+		{"no separator", encode("2024-05-01T10:00:00Z")},
+		{"bad time", encode("yesterday|1")},
+		{"bad id", encode("2024-05-01T10:00:00Z|abc")},
+		{"empty id", encode("2024-05-01T10:00:00Z|")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) err = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed   = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("you have already voted in this poll")
+	ErrInvalidVote  = errors.New("invalid poll options")
+)
+
+// 投票选项数量的限制
+const (
+	MinPollOptions = 2
+	MaxPollOptions = 6
+)
+
+// 帖子上的投票
+type Poll struct {
+	ID        int64        `json:"id"`
+	PostID    int64        `json:"post_id"`
+	Multiple  bool         `json:"multiple"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Closed    bool         `json:"closed"`
+	Options   []PollOption `json:"options"`
+	//当前用户的投票
+	Voted    bool    `json:"voted"`
+	OwnVotes []int64 `json:"own_votes"`
+	//结果在投票之后或者投票结束之后才可见,不可见时为空
+	TotalVoters *int `json:"total_voters"`
+}
+
+// 投票的选项
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes *int   `json:"votes"`
+}
+
+// Poll的存储
+type PollStore struct {
+	db *sql.DB
+}
+
+// 在创建帖子的事务中创建投票
+func createPoll(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `
+		INSERT INTO polls (post_id , multiple , expires_at)
+		VALUES ($1,$2,$3) RETURNING id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	if err := tx.QueryRowContext(ctx, query, postID, poll.Multiple, poll.ExpiresAt).Scan(&poll.ID); err != nil {
+		return err
+	}
+	poll.PostID = postID
+	for i := range poll.Options {
+		err := tx.QueryRowContext(
+			ctx,
+			`INSERT INTO poll_options (poll_id , position , text) VALUES ($1,$2,$3) RETURNING id`,
+			poll.ID,
+			i,
+			poll.Options[i].Text,
+		).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	poll.Closed = !time.Now().Before(poll.ExpiresAt)
+	poll.OwnVotes = []int64{}
+	return nil
+}
+
+// 得到这些帖子的投票,结果按viewerID是否投过票决定是否可见
+func (s *PollStore) GetByPostIDs(ctx context.Context, postIDs []int64, viewerID int64) ([]Poll, error) {
+	query := `
+		SELECT pl.id , pl.post_id , pl.multiple , pl.expires_at ,
+			o.id , o.text , COUNT(v.user_id) ,
+			EXISTS (SELECT 1 FROM poll_voters pv WHERE pv.poll_id = pl.id AND pv.user_id = $2) ,
+			BOOL_OR(v.user_id = $2) IS TRUE ,
+			(SELECT COUNT(*) FROM poll_voters pv WHERE pv.poll_id = pl.id)
+		FROM polls pl
+		JOIN poll_options o ON o.poll_id = pl.id
+		LEFT JOIN poll_votes v ON v.option_id = o.id
+		WHERE pl.post_id = ANY($1)
+		GROUP BY pl.id , o.id
+		ORDER BY pl.post_id , o.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	polls := []Poll{}
+	now := time.Now()
+	for rows.Next() {
+		var (
+			p        Poll
+			o        PollOption
+			votes    int
+			ownVote  bool
+			voterCnt int
+		)
+		err := rows.Scan(
+			&p.ID,
+			&p.PostID,
+			&p.Multiple,
+			&p.ExpiresAt,
+			&o.ID,
+			&o.Text,
+			&votes,
+			&p.Voted,
+			&ownVote,
+			&voterCnt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		//同一个投票的选项是连续的
+		if len(polls) == 0 || polls[len(polls)-1].ID != p.ID {
+			p.Closed = !now.Before(p.ExpiresAt)
+			p.Options = []PollOption{}
+			p.OwnVotes = []int64{}
+			if p.Voted || p.Closed {
+				p.TotalVoters = &voterCnt
+			}
+			polls = append(polls, p)
+		}
+		last := &polls[len(polls)-1]
+		if last.TotalVoters != nil {
+			o.Votes = &votes
+		}
+		if ownVote {
+			last.OwnVotes = append(last.OwnVotes, o.ID)
+		}
+		last.Options = append(last.Options, o)
+	}
+	return polls, rows.Err()
+}
+
+// 投票,每个用户只能投一次,单选投票只能选一个选项
+func (s *PollStore) Vote(ctx context.Context, postID int64, userID int64, optionIDs []int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		var (
+			pollID    int64
+			multiple  bool
+			expiresAt time.Time
+		)
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT id , multiple , expires_at FROM polls WHERE post_id = $1`,
+			postID,
+		).Scan(&pollID, &multiple, &expiresAt)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if !time.Now().Before(expiresAt) {
+			return ErrPollClosed
+		}
+		if len(optionIDs) == 0 || (!multiple && len(optionIDs) > 1) {
+			return ErrInvalidVote
+		}
+		//选项必须属于这个投票且不重复
+		var valid int
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*) FROM poll_options WHERE poll_id = $1 AND id = ANY($2)`,
+			pollID,
+			pq.Array(optionIDs),
+		).Scan(&valid)
+		if err != nil {
+			return err
+		}
+		if valid != len(optionIDs) {
+			return ErrInvalidVote
+		}
+		//主键保证每个用户只有一张选票
+		res, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO poll_voters (poll_id , user_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`,
+			pollID,
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrAlreadyVoted
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO poll_votes (poll_id , option_id , user_id) SELECT $1 , unnest($2::bigint[]) , $3`,
+			pollID,
+			pq.Array(optionIDs),
+			userID,
+		)
+		return err
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
@@ -11,21 +12,73 @@ import (
 
 // post模型
 type Post struct {
-	ID        int64    `json:"id"`
-	Content   string   `json:"content"`
-	Title     string   `json:"title"`
-	UserID    int64    `json:"user_id"`
-	Tags      []string `json:"tags"`
-	CreatedAt string   `json:"created_at"`
-	UpdatedAt string   `json:"updated_at"`
+	ID      int64  `json:"id"`
+	Content string `json:"content"`
+	//由Content渲染的HTML,只读,回写之前由API层填充
+	ContentHTML string   `json:"content_html"`
+	Title       string   `json:"title"`
+	UserID      int64    `json:"user_id"`
+	Tags        []string `json:"tags"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
 
 	//连接的外表
 	Comments []Comment `json:"comment"`
 	User     User      `json:"user"`
+	//正文中的@提及
+	Mentions []Mention `json:"mentions"`
 	//乐观锁
 	Version int64 `json:"version"`
+	//发布状态
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	//最后一次编辑的时间,为空表示发布后没有被编辑过
+	EditedAt *time.Time `json:"edited_at"`
+	//可见范围
+	Visibility string `json:"visibility"`
+	//附件,创建时通过AttachmentIDs指定
+	Attachments   []Media `json:"attachments"`
+	AttachmentIDs []int64 `json:"-"`
+	//投票,创建时一起写入
+	Poll *Poll `json:"poll"`
+	//置顶的时间,没有置顶时为空
+	PinnedAt *time.Time `json:"pinned_at"`
+	//用户显式指定的标签,Tags由它和正文中的hashtag合并得到
+	//创建时为nil表示Tags都是显式的,更新时为nil表示不变
+	ExplicitTags []string `json:"-"`
 }
 
+// 帖子的可见范围
+const (
+	VisibilityPublic    = "public"    //所有人
+	VisibilityFollowers = "followers" //作者的粉丝
+	VisibilityMentioned = "mentioned" //正文中被提及的人
+	VisibilityPrivate   = "private"   //只有作者自己
+)
+
+// 查看者能否看到帖子的SQL条件,alias是posts表的别名,viewer是查看者ID的占位符
+// 作者本人总是能看到自己的帖子
+func visibleTo(alias string, viewer string) string {
+	return fmt.Sprintf(`(%[1]s.user_id = %[2]s OR %[1]s.visibility = 'public'
+		OR (%[1]s.visibility = 'followers' AND EXISTS (
+			SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s.user_id AND vf.follower_id = %[2]s))
+		OR (%[1]s.visibility = 'mentioned' AND EXISTS (
+			SELECT 1 FROM mentions vm WHERE vm.post_id = %[1]s.id AND vm.comment_id IS NULL AND vm.user_id = %[2]s)))`,
+		alias, viewer)
+}
+
+// 帖子的发布状态
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// 每个用户最多置顶的帖子数
+const MaxPinnedPosts = 3
+
+var ErrPinLimit = fmt.Errorf("you can pin at most %d posts", MaxPinnedPosts)
+
 // Post的元数据
 type PostWithMetadata struct {
 	Post
@@ -39,22 +92,63 @@ type PostStore struct {
 
 // 实现Create接口
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, post); err != nil {
+			return err
+		}
+		//解析正文中的提及
+		mentions, err := saveMentions(ctx, tx, post.UserID, post.ID, nil, post.Content)
+		if err != nil {
+			return err
+		}
+		post.Mentions = mentions
+		//挂上附件
+		attachments, err := attachMedia(ctx, tx, post.ID, post.UserID, post.AttachmentIDs)
+		if err != nil {
+			return err
+		}
+		post.Attachments = attachments
+		//创建投票
+		if post.Poll != nil {
+			if err := createPoll(ctx, tx, post.ID, post.Poll); err != nil {
+				return err
+			}
+		}
+		if post.Status == PostStatusPublished {
+			return addEvent(ctx, tx, EventPostCreated, PostEvent{PostID: post.ID, UserID: post.UserID})
+		}
+		return nil
+	})
+}
+
+func (s *PostStore) create(ctx context.Context, tx *sql.Tx, post *Post) error {
+	//默认直接发布,所有人可见
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
 	//SQL语句
 	query := `
-		INSERT INTO posts(content , title , user_id , tags)
-		VALUES($1,$2,$3,$4) RETURNING id ,created_at ,updated_at
+		INSERT INTO posts(content , title , user_id , tags , status , publish_at , visibility , explicit_tags)
+		VALUES($1,$2,$3,$4,$5,$6,$7,COALESCE($8::varchar[] , $4::varchar[] , '{}')) RETURNING id ,created_at ,updated_at
 	`
 	//超时控制
 	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
 	defer cancel()
 	//开始查询
-	err := s.db.QueryRowContext(
+	err := tx.QueryRowContext(
 		ctx,
 		query,
 		post.Content,
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.Status,
+		post.PublishAt,
+		post.Visibility,
+		pq.Array(post.ExplicitTags),
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -70,8 +164,8 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	query :=
 		`
-		SELECT id , user_id , title , created_at , updated_at , tags ,version
-		FROM posts WHERE id = $1
+		SELECT id , user_id , title , content , created_at , updated_at , tags ,version , status , publish_at , edited_at , visibility , pinned_at , explicit_tags
+		FROM posts WHERE id = $1 AND deleted_at IS NULL
 	`
 	//超时控制
 	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
@@ -86,16 +180,23 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.ID,
 		&post.UserID,
 		&post.Title,
+		&post.Content,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
 		&post.Version,
+		&post.Status,
+		&post.PublishAt,
+		&post.EditedAt,
+		&post.Visibility,
+		&post.PinnedAt,
+		pq.Array(&post.ExplicitTags),
 	)
 	//错误处理
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, err
+			return nil, ErrNotFound
 		default:
 			return nil, err
 		}
@@ -103,58 +204,122 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	return &post, nil
 }
 
-// Delete方法
-func (s *PostStore) Delete(ctx context.Context, postID int64) error {
-	//请求
-	query :=
+// Delete方法,软删除帖子以及帖子下的评论,deletedBy是执行删除的用户
+// 只有自己删除的帖子可以从回收站恢复
+func (s *PostStore) Delete(ctx context.Context, postID int64, deletedBy int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		//请求
+		query :=
+			`
+			UPDATE posts SET deleted_at = now() , deleted_by = $2 , pinned_at = NULL , updated_at = now()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING deleted_at
 		`
-		DELETE FROM posts WHERE id = $1
-	`
-	//超时控制
-	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
-	defer cancel()
-	//执行删除操作
-	res, err := s.db.ExecContext(ctx, query, postID)
-	if err != nil {
-		return err
-	}
-	//查看删除了多少行
-	rows, err := res.RowsAffected()
-	if err != nil {
+		//超时控制
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		//执行删除操作
+		var deletedAt time.Time
+		err := tx.QueryRowContext(ctx, query, postID, deletedBy).Scan(&deletedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		//评论使用同一个删除时间,恢复帖子时一起恢复
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE comments SET deleted_at = $2 , deleted_by = $3 , updated_at = $2 WHERE post_id = $1 AND deleted_at IS NULL`,
+			postID,
+			deletedAt,
+			deletedBy,
+		)
 		return err
-	}
-	//删除0行，没有找到
-	if rows == 0 {
-		return ErrNotFound
-	}
-	return nil
+	})
 }
 
-// Patch方法
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+// Patch方法,editorID是执行编辑的用户
+func (s *PostStore) Update(ctx context.Context, post *Post, editorID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		//编辑前是否已经发布,版本号保证读到的状态没有被并发修改
+		var wasPublished bool
+		err := tx.QueryRowContext(ctx, `SELECT status = 'published' FROM posts WHERE id = $1`, post.ID).Scan(&wasPublished)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+		//保存编辑前的内容
+		if err := saveRevision(ctx, tx, post.ID, post.Version, editorID); err != nil {
+			return err
+		}
+		if err := s.update(ctx, tx, post); err != nil {
+			return err
+		}
+		//正文变了,重新解析提及
+		if err := deletePostMentions(ctx, tx, post.ID); err != nil {
+			return err
+		}
+		mentions, err := saveMentions(ctx, tx, post.UserID, post.ID, nil, post.Content)
+		if err != nil {
+			return err
+		}
+		post.Mentions = mentions
+		if post.Status != PostStatusPublished {
+			return nil
+		}
+		ev := EventPostCreated
+		if wasPublished {
+			ev = EventPostUpdated
+		}
+		return addEvent(ctx, tx, ev, PostEvent{PostID: post.ID, UserID: post.UserID})
+	})
+}
+
+func (s *PostStore) update(ctx context.Context, tx *sql.Tx, post *Post) error {
+	//从未发布变成发布时,created_at更新为发布的时间,这样在feed中按发布时间排序
 	query := `
 		UPDATE posts
-		SET title = $1 , content = $2 , version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
+		SET title = $1 , content = $2 , tags = $3 , status = $4 , publish_at = $5 , visibility = $8 , explicit_tags = COALESCE($9::varchar[] , explicit_tags) ,
+			created_at = CASE WHEN status <> 'published' AND $4 = 'published' THEN now() ELSE created_at END ,
+			edited_at = CASE WHEN status = 'published' THEN now() ELSE edited_at END ,
+			updated_at = now() ,
+			version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING version , created_at , updated_at , edited_at
 	`
 	//超时控制
 	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
 	defer cancel()
 	//执行Patch操作
-	err := s.db.QueryRowContext(
+	err := tx.QueryRowContext(
 		ctx,
 		query,
 		post.Title,
 		post.Content,
+		pq.Array(post.Tags),
+		post.Status,
+		post.PublishAt,
 		post.ID,
-		post.Version).Scan(
+		post.Version,
+		post.Visibility,
+		pq.Array(post.ExplicitTags)).Scan(
 		&post.Version,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.EditedAt,
 	)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrNotFound):
-			return ErrNotFound
+		//版本号不匹配,被别人抢先修改了
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
 		default:
 			return err
 		}
@@ -174,15 +339,18 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq Pagination
 		p.updated_at,
 		p.version,
 		p.tags,
+		p.edited_at,
+		p.visibility,
 		u.username,
 		COUNT(c.id) AS comments_count
 	FROM posts p
-	LEFT JOIN comments c ON c.post_id = p.id
+	LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
 	LEFT JOIN users u ON p.user_id = u.id
-	JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-	WHERE f.user_id = $1 OR p.user_id = $1 AND 
+	WHERE p.status = 'published' AND p.deleted_at IS NULL AND
+		  (p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
+		  ` + visibleTo("p", "$1") + ` AND
 		  (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')  AND
-		  (p.tags @> $5 OR $5 = '{}' )
+		  ($5::varchar[] IS NULL OR cardinality($5::varchar[]) = 0 OR p.tags @> $5)
 	GROUP BY p.id , u.username
 	ORDER BY p.created_at ` + fq.Sort + `
 	LIMIT $2 OFFSET $3
@@ -218,6 +386,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq Pagination
 			&post.UpdatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.Visibility,
 			&post.User.Username,
 			&post.CommentCount,
 		)
@@ -228,3 +398,291 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq Pagination
 	}
 	return feed, nil
 }
+
+// 得到用户的草稿和定时发布的帖子
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64) ([]Post, error) {
+	query := `
+		SELECT id , user_id , title , content , created_at , updated_at , tags , version , status , publish_at , visibility
+		FROM posts
+		WHERE user_id = $1 AND status <> 'published' AND deleted_at IS NULL
+		ORDER BY updated_at DESC , id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.Status,
+			&post.PublishAt,
+			&post.Visibility,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// 发布已经到时间的定时帖子,返回被发布的帖子
+// 多个实例同时执行时用SKIP LOCKED避免重复发布
+func (s *PostStore) PublishDue(ctx context.Context, now time.Time) ([]Post, error) {
+	query := `
+		UPDATE posts
+		SET status = 'published' , created_at = now() , updated_at = now() , version = version + 1
+		WHERE id IN (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= $1 AND deleted_at IS NULL
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id , user_id , title , content , created_at , updated_at , tags , version , status , publish_at , visibility
+	`
+	posts := []Post{}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		rows, err := tx.QueryContext(ctx, query, now)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var post Post
+			err := rows.Scan(
+				&post.ID,
+				&post.UserID,
+				&post.Title,
+				&post.Content,
+				&post.CreatedAt,
+				&post.UpdatedAt,
+				pq.Array(&post.Tags),
+				&post.Version,
+				&post.Status,
+				&post.PublishAt,
+				&post.Visibility,
+			)
+			if err != nil {
+				return err
+			}
+			posts = append(posts, post)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		//发布和事件在同一个事务中
+		for _, post := range posts {
+			if err := addEvent(ctx, tx, EventPostCreated, PostEvent{PostID: post.ID, UserID: post.UserID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// 查看者能否看到这个帖子
+func (s *PostStore) CanView(ctx context.Context, postID int64, viewerID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND ` + visibleTo("p", "$2") + `)`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	var ok bool
+	if err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// 作者主页的帖子,第一页先返回置顶的帖子(按置顶时间倒序,不占用limit),其余按fq排序
+// 传入cursor时使用游标分页,返回下一页的cursor,没有下一页时为空
+func (s *PostStore) GetUserPosts(ctx context.Context, authorID int64, viewerID int64, fq PaginationFeedQuery) ([]PostWithMetadata, string, error) {
+	posts := []PostWithMetadata{}
+	if fq.Offset == 0 && fq.Cursor == "" {
+		pinned, err := s.queryUserPosts(ctx, authorID, viewerID, fq, "p.pinned_at IS NOT NULL", "p.pinned_at DESC", MaxPinnedPosts, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		posts = append(posts, pinned...)
+	}
+	cond := "p.pinned_at IS NULL"
+	var args []any
+	if fq.Cursor != "" {
+		c, err := DecodeCursor(fq.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		op := "<"
+		if fq.Sort == "asc" {
+			op = ">"
+		}
+		cond += " AND (p.created_at , p.id) " + op + " ($8::timestamptz , $9::bigint)"
+		args = append(args, c.CreatedAt, c.ID)
+	}
+	order := "p.created_at " + fq.Sort + " , p.id " + fq.Sort
+	rest, err := s.queryUserPosts(ctx, authorID, viewerID, fq, cond, order, fq.Limit, fq.Offset, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	posts = append(posts, rest...)
+	//这一页满了才有下一页
+	next := ""
+	if len(rest) == fq.Limit {
+		last := rest[len(rest)-1]
+		next = EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return posts, next, nil
+}
+
+// 作者主页帖子的查询,cond和order是额外的条件和排序,extra从$8开始
+func (s *PostStore) queryUserPosts(ctx context.Context, authorID int64, viewerID int64, fq PaginationFeedQuery, cond string, order string, limit int, offset int, extra ...any) ([]PostWithMetadata, error) {
+	query := `
+	SELECT
+		p.id,
+		p.user_id,
+		p.title,
+		p.content,
+		p.created_at,
+		p.updated_at,
+		p.version,
+		p.tags,
+		p.edited_at,
+		p.visibility,
+		p.pinned_at,
+		u.username,
+		COUNT(c.id) AS comments_count
+	FROM posts p
+	LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
+	LEFT JOIN users u ON p.user_id = u.id
+	WHERE p.user_id = $1 AND p.status = 'published' AND p.deleted_at IS NULL AND
+		  ` + visibleTo("p", "$2") + ` AND
+		  (p.title ILIKE '%' || $3 || '%' OR p.content ILIKE '%' || $3 || '%') AND
+		  ($4::varchar[] IS NULL OR cardinality($4::varchar[]) = 0 OR p.tags @> $4) AND
+		  ($5 = '' OR p.created_at >= $5::timestamp) AND
+		  ` + cond + `
+	GROUP BY p.id , u.username
+	ORDER BY ` + order + `
+	LIMIT $6 OFFSET $7
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	args := append([]any{
+		authorID,
+		viewerID,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		limit,
+		offset,
+	}, extra...)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.EditedAt,
+			&post.Visibility,
+			&post.PinnedAt,
+			&post.User.Username,
+			&post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// 置顶自己已经发布的帖子,已经置顶的不做修改
+func (s *PostStore) Pin(ctx context.Context, postID int64, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		//锁住用户,避免并发置顶超过上限
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+		var pinned bool
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT pinned_at IS NOT NULL FROM posts
+			WHERE id = $1 AND user_id = $2 AND status = 'published' AND deleted_at IS NULL`,
+			postID,
+			userID,
+		).Scan(&pinned)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if pinned {
+			return nil
+		}
+		var count int
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*) FROM posts
+			WHERE user_id = $1 AND pinned_at IS NOT NULL AND status = 'published' AND deleted_at IS NULL`,
+			userID,
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count >= MaxPinnedPosts {
+			return ErrPinLimit
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET pinned_at = now() WHERE id = $1`, postID)
+		return err
+	})
+}
+
+// 取消置顶
+func (s *PostStore) Unpin(ctx context.Context, postID int64, userID int64) error {
+	query := `UPDATE posts SET pinned_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, postID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// 帖子的修订记录,保存的是某次编辑之前的内容
+type Revision struct {
+	ID        int64    `json:"id"`
+	PostID    int64    `json:"post_id"`
+	Version   int64    `json:"version"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	EditorID  *int64   `json:"editor_id"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// Revision的存储
+type RevisionStore struct {
+	db *sql.DB
+}
+
+// 在更新之前保存帖子当前的内容,版本不匹配时不会写入
+func saveRevision(ctx context.Context, tx *sql.Tx, postID int64, version int64, editorID int64) error {
+	query := `
+		INSERT INTO post_revisions (post_id , version , title , content , tags , editor_id)
+		SELECT id , version , title , content , tags , $3
+		FROM posts WHERE id = $1 AND version = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, postID, version, editorID)
+	return err
+}
+
+// 得到帖子的全部修订记录,按版本从旧到新
+func (s *RevisionStore) GetByPostID(ctx context.Context, postID int64) ([]Revision, error) {
+	query := `
+		SELECT id , post_id , version , title , content , tags , editor_id , created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY version ASC , id ASC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []Revision{}
+	for rows.Next() {
+		var rev Revision
+		err := rows.Scan(
+			&rev.ID,
+			&rev.PostID,
+			&rev.Version,
+			&rev.Title,
+			&rev.Content,
+			pq.Array(&rev.Tags),
+			&rev.EditorID,
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// 得到帖子的某一条修订记录
+func (s *RevisionStore) GetByID(ctx context.Context, postID int64, revisionID int64) (*Revision, error) {
+	query := `
+		SELECT id , post_id , version , title , content , tags , editor_id , created_at
+		FROM post_revisions
+		WHERE post_id = $1 AND id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rev := &Revision{}
+	err := s.db.QueryRowContext(ctx, query, postID, revisionID).Scan(
+		&rev.ID,
+		&rev.PostID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Content,
+		pq.Array(&rev.Tags),
+		&rev.EditorID,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return rev, nil
+}
@@ -13,6 +13,7 @@ var (
 	ErrConflict          = errors.New("resource already exists")
 	ErrDuplicateEmail    = errors.New("duplicate email")
 	ErrDuplicateUsername = errors.New("duplicate username")
+	ErrEditConflict      = errors.New("edit conflict")
 )
 
 type Storage struct {
@@ -23,11 +24,20 @@ type Storage struct {
 		//POST请求
 		Create(context.Context, *Post) error
 		//PATCH请求
-		Update(context.Context, *Post) error
+		Update(context.Context, *Post, int64) error
 		//DELETE请求
-		Delete(context.Context, int64) error
+		Delete(context.Context, int64, int64) error
 		//
 		GetUserFeed(context.Context, int64, PaginationFeedQuery) ([]PostWithMetadata, error)
+		//草稿和定时发布
+		GetDrafts(context.Context, int64) ([]Post, error)
+		PublishDue(context.Context, time.Time) ([]Post, error)
+		//可见范围
+		CanView(context.Context, int64, int64) (bool, error)
+		//作者主页和置顶
+		GetUserPosts(context.Context, int64, int64, PaginationFeedQuery) ([]PostWithMetadata, string, error)
+		Pin(context.Context, int64, int64) error
+		Unpin(context.Context, int64, int64) error
 	}
 	//User接口
 	Users interface {
@@ -37,6 +47,12 @@ type Storage struct {
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		ScheduleDeletion(context.Context, int64, time.Time) error
+		CancelDeletion(context.Context, int64) error
+		GetDueDeletions(context.Context, time.Time) ([]int64, error)
+		Purge(context.Context, int64, DeletionPolicy) error
+		SetDMPolicy(context.Context, int64, string) error
+		CreateInvitation(context.Context, int64, string, time.Duration) (bool, error)
 	}
 	//Comments接口
 	Comment interface {
@@ -44,16 +60,119 @@ type Storage struct {
 		GetPostByID(context.Context, int64) ([]Comment, error)
 		//创建评论
 		Create(context.Context, *Comment) error
+		GetByID(context.Context, int64) (*Comment, error)
+		//软删除评论
+		Delete(context.Context, int64, int64) error
 	}
 	Followers interface {
 		//关注某人
 		Follow(context.Context, int64, int64) error
 		Unfollow(context.Context, int64, int64) error
+		//推荐关注
+		Suggestions(context.Context, int64, int) ([]Suggestion, error)
+		FollowingIDs(context.Context, int64) ([]int64, error)
 	}
 	//角色表
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	//@提及
+	Mentions interface {
+		GetByPostIDs(context.Context, []int64) ([]Mention, error)
+		GetByUserID(context.Context, int64, PaginationFeedQuery) ([]MentionWithContext, error)
+	}
+	//帖子的修订记录
+	Revisions interface {
+		GetByPostID(context.Context, int64) ([]Revision, error)
+		GetByID(context.Context, int64, int64) (*Revision, error)
+	}
+	//媒体文件
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(context.Context, int64) (*Media, error)
+		GetByPostIDs(context.Context, []int64) ([]Media, error)
+		ClaimForProcessing(context.Context, int64) (*Media, error)
+		CompleteProcessing(context.Context, *Media) error
+		FailProcessing(context.Context, int64) error
+		RequeueStalled(context.Context, time.Time) ([]int64, error)
+		PurgeUnattached(context.Context, time.Time) error
+		GetBlobDeletions(context.Context, int) ([]string, error)
+		RemoveBlobDeletions(context.Context, []string) error
+	}
+	//回收站
+	Trash interface {
+		GetByUserID(context.Context, int64) (*Trash, error)
+		RestorePost(context.Context, int64, int64) error
+		RestoreComment(context.Context, int64, int64) error
+		Purge(context.Context, time.Time) error
+	}
+	//标签
+	Tags interface {
+		Search(context.Context, string, int) ([]Tag, error)
+	}
+	//个人数据导出
+	Exports interface {
+		Request(context.Context, int64) error
+		Collect(context.Context, int64) (*UserExport, error)
+	}
+	//投票
+	Polls interface {
+		GetByPostIDs(context.Context, []int64, int64) ([]Poll, error)
+		Vote(context.Context, int64, int64, []int64) error
+	}
+	//私信
+	Conversations interface {
+		Create(context.Context, int64, []int64, *string) (*Conversation, bool, error)
+		GetByID(context.Context, int64, int64) (*Conversation, error)
+		GetByUserID(context.Context, int64, string, int) ([]Conversation, string, error)
+		MemberIDs(context.Context, int64) ([]int64, error)
+		Send(context.Context, *Message) error
+		GetMessages(context.Context, int64, int64, int64, int) ([]Message, error)
+		MarkRead(context.Context, int64, int64, int64) error
+	}
+	//通知
+	Notifications interface {
+		Create(context.Context, []Notification) ([]Notification, error)
+		GetGroups(context.Context, int64, int64, int) ([]NotificationGroup, error)
+		UnreadCount(context.Context, int64) (int, error)
+		MarkRead(context.Context, int64, []int64) error
+	}
+	//邮件偏好和摘要
+	EmailPreferences interface {
+		Get(context.Context, int64) (map[string]string, error)
+		Set(context.Context, int64, map[string]string) error
+		ImmediateEmails(context.Context, []int64) ([]NotificationEmail, error)
+		DueDigests(context.Context, string, time.Time, time.Time, int64, int) ([]Digest, error)
+		MarkDigestSent(context.Context, int64, string, time.Time) error
+	}
+	//webhook订阅和投递
+	Webhooks interface {
+		Create(context.Context, *Webhook) error
+		GetAll(context.Context) ([]Webhook, error)
+		GetByID(context.Context, int64) (*Webhook, error)
+		Update(context.Context, *Webhook) error
+		Delete(context.Context, int64) error
+		Enqueue(context.Context, string, []byte) error
+		ClaimDue(context.Context, time.Duration, int) ([]WebhookDelivery, error)
+		RecordAttempt(context.Context, *WebhookDelivery) error
+		GetDeliveries(context.Context, int64, int64, int) ([]WebhookDelivery, error)
+		Redeliver(context.Context, int64, int64) (*WebhookDelivery, error)
+	}
+	//领域事件的发件箱
+	Outbox interface {
+		ClaimDue(context.Context, time.Duration, int) ([]OutboxEvent, error)
+		RecordAttempt(context.Context, *OutboxEvent) error
+		Purge(context.Context, time.Time) error
+	}
+	//邮件发送队列
+	EmailJobs interface {
+		Enqueue(context.Context, *EmailJob) error
+		ClaimNext(context.Context, time.Duration) (*EmailJob, error)
+		RecordAttempt(context.Context, *EmailJob) error
+		GetDead(context.Context, int64, int) ([]EmailJob, error)
+		Retry(context.Context, int64) (*EmailJob, error)
+		PurgeSent(context.Context, time.Time) error
+	}
 }
 
 // 初始化PG存储
@@ -74,6 +193,45 @@ func NewPostgreStorage(db *sql.DB) *Storage {
 		Roles: &RoleStorage{
 			db: db,
 		},
+		Mentions: &MentionStore{
+			db: db,
+		},
+		Revisions: &RevisionStore{
+			db: db,
+		},
+		Media: &MediaStore{
+			db: db,
+		},
+		Trash: &TrashStore{
+			db: db,
+		},
+		Tags: &TagStore{
+			db: db,
+		},
+		Exports: &ExportStorage{
+			db: db,
+		},
+		Polls: &PollStore{
+			db: db,
+		},
+		Notifications: &NotificationStore{
+			db: db,
+		},
+		Conversations: &ConversationStore{
+			db: db,
+		},
+		EmailPreferences: &EmailPreferenceStore{
+			db: db,
+		},
+		Webhooks: &WebhookStore{
+			db: db,
+		},
+		Outbox: &OutboxStore{
+			db: db,
+		},
+		EmailJobs: &EmailJobStore{
+			db: db,
+		},
 	}
 }
 
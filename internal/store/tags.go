@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxTags      = 10 //每个帖子最多的标签数量
+	MaxTagLength = 50 //单个标签最长的rune数,数据库中是VARCHAR(100)
+)
+
+var (
+	ErrInvalidTag  = errors.New("tags may only contain letters, digits, '_' and '-'")
+	ErrTooManyTags = fmt.Errorf("a post can have at most %d tags", MaxTags)
+)
+
+// 标签以及使用的次数
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Tag的存储
+type TagStore struct {
+	db *sql.DB
+}
+
+// 规范化单个标签:去掉#前缀,转小写,检查长度和字符
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	tag = strings.ToLower(tag)
+	length := utf8.RuneCountInString(tag)
+	if length == 0 || length > MaxTagLength {
+		return "", fmt.Errorf("tag %q must be between 1 and %d characters", tag, MaxTagLength)
+	}
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+	}
+	return tag, nil
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+// 从正文中解析出#hashtag
+func ParseHashtags(content string) []string {
+	runes := []rune(content)
+	tags := []string{}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' {
+			continue
+		}
+		//类似abc#def的不算标签
+		if i > 0 && isTagRune(runes[i-1]) {
+			continue
+		}
+		//链接中的#anchor不算标签
+		if inURL(runes, i) {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && isTagRune(runes[j]) {
+			j++
+		}
+		if j > i+1 {
+			tags = append(tags, string(runes[i+1:j]))
+		}
+		i = j - 1
+	}
+	return tags
+}
+
+// runes[i]是否在一个链接里面,链接是包含://或者以www.开头的一段不含空白的文字
+func inURL(runes []rune, i int) bool {
+	start := i
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	word := string(runes[start:i])
+	return strings.Contains(word, "://") || strings.HasPrefix(word, "www.")
+}
+
+// 合并显式的标签和正文中的hashtag,去重并保持顺序
+// 显式的标签不合法或者超过MaxTags会返回错误,正文中不合法的hashtag直接忽略
+// 正文中的hashtag只补到MaxTags为止,超出的不算标签
+func NormalizeTags(explicit []string, content string) ([]string, error) {
+	tags := []string{}
+	seen := map[string]bool{}
+	add := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	for _, t := range explicit {
+		tag, err := NormalizeTag(t)
+		if err != nil {
+			return nil, err
+		}
+		add(tag)
+	}
+	if len(tags) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	for _, t := range ParseHashtags(content) {
+		if len(tags) == MaxTags {
+			break
+		}
+		tag, err := NormalizeTag(t)
+		if err != nil {
+			continue
+		}
+		add(tag)
+	}
+	return tags, nil
+}
+
+// 按现在的规则重新规范化已经保存的标签,不合法的和超过MaxTags的直接丢弃
+func ValidTags(tags []string) []string {
+	valid := []string{}
+	for _, t := range tags {
+		if len(valid) == MaxTags {
+			break
+		}
+		tag, err := NormalizeTag(t)
+		if err != nil || slices.Contains(valid, tag) {
+			continue
+		}
+		valid = append(valid, tag)
+	}
+	return valid
+}
+
+// 按前缀查找使用最多的标签
+func (s *TagStore) Search(ctx context.Context, prefix string, limit int) ([]Tag, error) {
+	query := `
+		SELECT t.tag , COUNT(*) AS uses
+		FROM posts p, unnest(p.tags) AS t(tag)
+		WHERE p.status = 'published' AND p.deleted_at IS NULL AND p.visibility = 'public' AND left(t.tag, length($1)) = $1
+		GROUP BY t.tag
+		ORDER BY uses DESC , t.tag
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
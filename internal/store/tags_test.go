@@ -0,0 +1,81 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", []string{}},
+		{"single", "hello #go", []string{"go"}},
+		{"start of text", "#go is fun", []string{"go"}},
+		{"multiple", "#go and #rust-lang", []string{"go", "rust-lang"}},
+		{"punctuation ends tag", "(#go), #db.", []string{"go", "db"}},
+		{"unicode", "学习 #编程 today", []string{"编程"}},
+		{"inside word", "abc#def", []string{}},
+		{"bare hash", "# and ##", []string{}},
+		{"url fragment after slash", "see https://x/#anchor", []string{}},
+		{"url fragment after path", "see https://x.com/page#anchor #go", []string{"go"}},
+		{"url fragment after query", "https://x.com/?a=#frag", []string{}},
+		{"www link", "www.example.com/#top", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHashtags(tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseHashtags(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, MaxTags)
+	for i := range many {
+		many[i] = "t" + string(rune('a'+i))
+	}
+	tests := []struct {
+		name     string
+		explicit []string
+		content  string
+		want     []string
+		err      error
+	}{
+		{"explicit only", []string{"Go", "#db"}, "", []string{"go", "db"}, nil},
+		{"merged and deduplicated", []string{"go"}, "#Go #db", []string{"go", "db"}, nil},
+		{"invalid hashtag ignored", nil, "#" + strings.Repeat("a", MaxTagLength+1) + " #ok", []string{"ok"}, nil},
+		{"invalid explicit", []string{"a b"}, "", nil, ErrInvalidTag},
+		{"too many explicit", append(slices.Clone(many), "extra"), "", nil, ErrTooManyTags},
+		{"hashtags stop at cap", many, "#extra", many, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.explicit, tt.content)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeTags: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidTags(t *testing.T) {
+	got := ValidTags([]string{"Go", "go", "bad tag", "#db"})
+	if want := []string{"go", "db"}; !slices.Equal(got, want) {
+		t.Errorf("ValidTags = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 回收站中的内容
+type Trash struct {
+	Posts    []DeletedPost    `json:"posts"`
+	Comments []DeletedComment `json:"comments"`
+}
+
+// 被删除的帖子
+type DeletedPost struct {
+	Post
+	DeletedAt string `json:"deleted_at"`
+}
+
+// 被删除的评论
+type DeletedComment struct {
+	Comment
+	DeletedAt string `json:"deleted_at"`
+}
+
+// 回收站的存储
+type TrashStore struct {
+	db *sql.DB
+}
+
+// 得到用户回收站中自己删除的帖子和评论,被管理员或者帖子作者删除的不在回收站中
+// 随帖子一起被删除的评论不单独列出,恢复帖子时会一起恢复
+func (s *TrashStore) GetByUserID(ctx context.Context, userID int64) (*Trash, error) {
+	trash := &Trash{
+		Posts:    []DeletedPost{},
+		Comments: []DeletedComment{},
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	//帖子
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id , user_id , title , content , tags , created_at , updated_at , version , status , deleted_at
+		FROM posts
+		WHERE user_id = $1 AND deleted_at IS NOT NULL AND deleted_by = $1
+		ORDER BY deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p DeletedPost
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+			&p.Status,
+			&p.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		trash.Posts = append(trash.Posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	//评论
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT c.id , c.post_id , c.user_id , c.content , c.created_at , c.updated_at , c.deleted_at
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NOT NULL AND c.deleted_by = $1 AND p.deleted_at IS NULL
+		ORDER BY c.deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c DeletedComment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		trash.Comments = append(trash.Comments, c)
+	}
+	return trash, rows.Err()
+}
+
+// 恢复用户自己删除的帖子,以及和帖子一起被删除的评论
+func (s *TrashStore) RestorePost(ctx context.Context, userID int64, postID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		var deletedAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT deleted_at FROM posts
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL AND deleted_by = $2
+			FOR UPDATE
+		`, postID, userID).Scan(&deletedAt)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE posts SET deleted_at = NULL , deleted_by = NULL , updated_at = now() WHERE id = $1`, postID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE comments SET deleted_at = NULL , deleted_by = NULL , updated_at = now() WHERE post_id = $1 AND deleted_at = $2`,
+			postID,
+			deletedAt,
+		)
+		return err
+	})
+}
+
+// 恢复用户自己删除的评论,所属的帖子必须还在
+func (s *TrashStore) RestoreComment(ctx context.Context, userID int64, commentID int64) error {
+	query := `
+		UPDATE comments c SET deleted_at = NULL , deleted_by = NULL , updated_at = now()
+		FROM posts p
+		WHERE c.id = $1 AND c.user_id = $2 AND c.deleted_at IS NOT NULL AND c.deleted_by = $2
+			AND p.id = c.post_id AND p.deleted_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, commentID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// 彻底删除before之前被删除的帖子和评论,帖子的附件放入blob_deletions
+func (s *TrashStore) Purge(ctx context.Context, before time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := deleteMedia(ctx, tx, `post_id IN (SELECT id FROM posts WHERE deleted_at < $1)`, before); err != nil {
+			return err
+		}
+		queries := []string{
+			`DELETE FROM comments WHERE deleted_at < $1 OR post_id IN (SELECT id FROM posts WHERE deleted_at < $1)`,
+			`DELETE FROM posts WHERE deleted_at < $1`,
+		}
+		ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+		defer cancel()
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, before); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
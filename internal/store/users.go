@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"fmt"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -21,8 +22,22 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	//计划删除的时间,为空表示没有删除计划
+	DeletionScheduledAt *string `json:"deletion_scheduled_at"`
+	//谁可以发私信
+	DMPolicy string `json:"dm_policy"`
 }
 
+// 删除账户时对帖子和评论的处理策略
+type DeletionPolicy string
+
+const (
+	//连同帖子和评论一起删除
+	DeletionCascade DeletionPolicy = "cascade"
+	//保留帖子和评论,抹去用户的身份信息
+	DeletionAnonymize DeletionPolicy = "anonymize"
+)
+
 // password 结构体
 type password struct {
 	text *string //原始的文本
@@ -82,7 +97,7 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	//SQL语句
 	query :=
 		`
-		SELECT users.id , username , email , password , created_at , updated_at,roles.*
+		SELECT users.id , username , email , password , created_at , updated_at , deletion_scheduled_at , dm_policy , roles.*
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1	AND is_active = true
@@ -103,6 +118,8 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 		&user.Password.hash,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletionScheduledAt,
+		&user.DMPolicy,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Description,
@@ -131,11 +148,35 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
 			return err
 		}
-		return nil
+		//欢迎邮件由事件的handler发送
+		return addEvent(ctx, tx, EventUserRegistered, UserRegistered{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+		})
 	})
 
 }
 
+// 给还没有激活的用户新建一个邀请,用户已经激活或者不存在时返回false
+func (s *UserStore) CreateInvitation(ctx context.Context, userID int64, token string, exp time.Duration) (bool, error) {
+	query := `
+		INSERT INTO user_invitations (token , user_id , expiry)
+		SELECT $1 , id , $3 FROM users WHERE id = $2 AND NOT is_active
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
 func (s *UserStore) createUserInvitation(
 	ctx context.Context,
 	tx *sql.Tx,
@@ -268,7 +309,12 @@ func (s *UserStore) Delete(ctx context.Context, userID int64) error {
 		return nil
 	})
 }
+
+// 删除用户,上传的文件放入blob_deletions
 func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error {
+	if err := deleteMedia(ctx, tx, `user_id = $1`, userID); err != nil {
+		return err
+	}
 	query := `DELETE FROM users WHERE id = $1`
 	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
 	defer cancel()
@@ -287,7 +333,7 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query :=
 		`
-		SELECT id ,username,email,password,created_at,updated_at
+		SELECT id ,username,email,password,created_at,updated_at,deletion_scheduled_at
 		FROM users
 		WHERE email = $1 AND is_active = true	
 	`
@@ -303,6 +349,7 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Password.hash,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletionScheduledAt,
 	)
 	if err != nil {
 		switch err {
@@ -315,3 +362,136 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return user, nil
 
 }
+
+// 计划在at时刻删除用户
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+		UPDATE users SET deletion_scheduled_at = $1
+		WHERE id = $2 AND is_active = true
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, at, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// 取消删除计划
+func (s *UserStore) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users SET deletion_scheduled_at = NULL
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// 得到已经到期需要删除的用户
+func (s *UserStore) GetDueDeletions(ctx context.Context, now time.Time) ([]int64, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 按照策略彻底删除用户
+func (s *UserStore) Purge(ctx context.Context, userID int64, policy DeletionPolicy) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		switch policy {
+		case DeletionCascade:
+			if err := s.deleteContent(ctx, tx, userID); err != nil {
+				return err
+			}
+			if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+				return err
+			}
+			return s.delete(ctx, tx, userID)
+		case DeletionAnonymize:
+			if err := s.anonymize(ctx, tx, userID); err != nil {
+				return err
+			}
+			return s.deleteUserInvitations(ctx, tx, userID)
+		default:
+			return fmt.Errorf("unknown deletion policy %q", policy)
+		}
+	})
+}
+
+// 删除用户的帖子,评论以及别人在这些帖子下的评论,上传的文件放入blob_deletions
+func (s *UserStore) deleteContent(ctx context.Context, tx *sql.Tx, userID int64) error {
+	if err := deleteMedia(ctx, tx, `user_id = $1`, userID); err != nil {
+		return err
+	}
+	queries := []string{
+		`DELETE FROM comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM posts WHERE user_id = $1`,
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 抹去用户的身份信息,帖子和评论保留但不再能关联到本人
+func (s *UserStore) anonymize(ctx context.Context, tx *sql.Tx, userID int64) error {
+	queries := []string{
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+		`
+		UPDATE users
+		SET username = 'deleted_user_' || id,
+			email = 'deleted_user_' || id || '@deleted.invalid',
+			password = '',
+			is_active = false,
+			deletion_scheduled_at = NULL
+		WHERE id = $1
+		`,
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 设置谁可以给用户发私信
+func (s *UserStore) SetDMPolicy(ctx context.Context, userID int64, policy string) error {
+	query := `UPDATE users SET dm_policy = $2 WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, policy)
+	return err
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 投递的状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" //重试次数用完
+)
+
+// 外部系统的webhook订阅
+type Webhook struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatedBy *int64   `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// 一次事件的投递,同时也是投递日志
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastResponse   *string         `json:"last_response"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+	//投递时使用
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+const webhookColumns = `id , url , secret , events , active , created_by , created_at , updated_at`
+
+// 按webhookColumns的顺序扫描
+func scanWebhook(row interface{ Scan(...any) error }, w *Webhook) error {
+	return row.Scan(
+		&w.ID,
+		&w.URL,
+		&w.Secret,
+		pq.Array(&w.Events),
+		&w.Active,
+		&w.CreatedBy,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+}
+
+const deliveryColumns = `id , webhook_id , event , payload , status , attempts , next_attempt_at ,
+		last_status_code , last_response , last_error , created_at , delivered_at`
+
+// 按deliveryColumns的顺序扫描
+func scanDelivery(row interface{ Scan(...any) error }, d *WebhookDelivery) error {
+	return row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastResponse,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+}
+
+// Webhook的存储
+type WebhookStore struct {
+	db *sql.DB
+}
+
+// 创建订阅
+func (s *WebhookStore) Create(ctx context.Context, w *Webhook) error {
+	query := `
+		INSERT INTO webhooks (url , secret , events , active , created_by)
+		VALUES ($1,$2,$3,$4,$5) RETURNING id , created_at , updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		w.URL,
+		w.Secret,
+		pq.Array(w.Events),
+		w.Active,
+		w.CreatedBy,
+	).Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt)
+}
+
+// 所有的订阅
+func (s *WebhookStore) GetAll(ctx context.Context) ([]Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// 通过ID得到订阅
+func (s *WebhookStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	w := &Webhook{}
+	if err := scanWebhook(s.db.QueryRowContext(ctx, query, id), w); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// 修改订阅的地址,事件和是否启用
+func (s *WebhookStore) Update(ctx context.Context, w *Webhook) error {
+	query := `
+		UPDATE webhooks SET url = $2 , events = $3 , active = $4 , updated_at = now()
+		WHERE id = $1 RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, w.ID, w.URL, pq.Array(w.Events), w.Active).Scan(&w.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// 删除订阅,投递日志一起删除
+func (s *WebhookStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// 给所有订阅了event的启用中的webhook创建投递
+func (s *WebhookStore) Enqueue(ctx context.Context, event string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id , event , payload)
+		SELECT id , $1 , $2 FROM webhooks WHERE active AND $1 = ANY(events)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, event, string(payload))
+	return err
+}
+
+// 领取到期的投递,领取的投递在lease之内不会被其他实例领取
+func (s *WebhookStore) ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $1)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT dd.id FROM webhook_deliveries dd
+			JOIN webhooks ww ON ww.id = dd.webhook_id AND ww.active
+			WHERE dd.status = 'pending' AND dd.next_attempt_at <= now()
+			ORDER BY dd.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF dd SKIP LOCKED)
+		RETURNING d.id , d.webhook_id , d.event , d.payload , d.attempts , w.url , w.secret
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, lease.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// 记录一次投递的结果,d.Status和d.NextAttemptAt由调用者决定
+func (s *WebhookStore) RecordAttempt(ctx context.Context, d *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2 , attempts = attempts + 1 , next_attempt_at = $3 ,
+			last_status_code = $4 , last_response = $5 , last_error = $6 ,
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN now() ELSE delivered_at END
+		WHERE id = $1
+		RETURNING attempts
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		d.ID,
+		d.Status,
+		d.NextAttemptAt,
+		d.LastStatusCode,
+		d.LastResponse,
+		d.LastError,
+	).Scan(&d.Attempts)
+}
+
+// 订阅的投递日志,按ID倒序,before为0时从最新的开始
+func (s *WebhookStore) GetDeliveries(ctx context.Context, webhookID int64, before int64, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, webhookID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// 重新投递,用同样的事件和内容创建一个新的投递,原来的日志保持不变
+func (s *WebhookStore) Redeliver(ctx context.Context, webhookID int64, deliveryID int64) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id , event , payload)
+		SELECT webhook_id , event , payload FROM webhook_deliveries WHERE id = $2 AND webhook_id = $1
+		RETURNING ` + deliveryColumns
+	ctx, cancel := context.WithTimeout(ctx, QueryDuration)
+	defer cancel()
+	d := &WebhookDelivery{}
+	if err := scanDelivery(s.db.QueryRowContext(ctx, query, webhookID, deliveryID), d); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 投递请求带上的头
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// 可以订阅的事件
+const (
+	EventPostCreated    = "post.created"
+	EventUserFollowed   = "user.followed"
+	EventCommentCreated = "comment.created"
+)
+
+// 所有可以订阅的事件
+var Events = []string{EventPostCreated, EventUserFollowed, EventCommentCreated}
+
+const (
+	//超过这个次数不再重试
+	MaxAttempts = 8
+	//第一次重试的等待时间,之后每次翻倍
+	baseBackoff = time.Second * 30
+	maxBackoff  = time.Hour
+	//只读取响应的开头,记录到投递日志
+	maxResponseBytes = 1024
+)
+
+// 对请求体签名,签名覆盖时间戳和请求体,格式为 sha256=<hex>
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 接收方验证签名,时间戳和当前时间相差超过tolerance时拒绝,防止重放
+func Verify(secret string, timestamp string, body []byte, signature string, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+	expected := Sign(secret, ts, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// 第attempt次失败之后等待多久再重试,attempt从1开始
+func Backoff(attempt int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// 投递的结果,请求没有发出去时StatusCode为0
+type Result struct {
+	StatusCode int
+	Response   string
+}
+
+// 发送投递请求的客户端
+type Client struct {
+	http *http.Client
+}
+
+// 新建客户端,timeout是单次投递的超时
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		http: &http.Client{Timeout: timeout},
+	}
+}
+
+// 投递一次,2xx以外的响应也返回错误
+func (c *Client) Deliver(ctx context.Context, url string, secret string, event string, deliveryID int64, body []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GopherSocial-Webhook/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	//读完剩下的响应,连接才能复用
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	//响应会写入数据库,去掉无效的UTF-8和NUL
+	response := strings.ReplaceAll(strings.ToValidUTF8(string(snippet), ""), "\x00", "")
+	result := Result{StatusCode: resp.StatusCode, Response: response}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+// 本地的接收方,记录收到的请求并用给定的状态码响应
+func newReceiver(t *testing.T, status int, body string) (*httptest.Server, chan *http.Request, chan []byte) {
+	t.Helper()
+	reqs := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %v", err)
+		}
+		reqs <- r
+		bodies <- b
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs, bodies
+}
+
+func TestDeliverSignsRequest(t *testing.T) {
+	srv, reqs, bodies := newReceiver(t, http.StatusOK, "ok")
+	payload := []byte(`{"id":1}`)
+
+	res, err := NewClient(time.Second).Deliver(context.Background(), srv.URL, testSecret, EventPostCreated, 42, payload)
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || res.Response != "ok" {
+		t.Fatalf("result = %+v, want 200 ok", res)
+	}
+
+	r, body := <-reqs, <-bodies
+	if r.Method != http.MethodPost {
+		t.Errorf("method = %s, want POST", r.Method)
+	}
+	if string(body) != string(payload) {
+		t.Errorf("body = %s, want %s", body, payload)
+	}
+	if got := r.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := r.Header.Get(HeaderEvent); got != EventPostCreated {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, EventPostCreated)
+	}
+	if got := r.Header.Get(HeaderDelivery); got != "42" {
+		t.Errorf("%s = %q, want 42", HeaderDelivery, got)
+	}
+	ts := r.Header.Get(HeaderTimestamp)
+	sig := r.Header.Get(HeaderSignature)
+	if !Verify(testSecret, ts, body, sig, time.Minute) {
+		t.Errorf("Verify rejected the signature %q for timestamp %q", sig, ts)
+	}
+}
+
+func TestVerifyRejectsTamperedAndStale(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now().Unix()
+	ts := strconv.FormatInt(now, 10)
+	sig := Sign(testSecret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", testSecret, ts, body, sig, true},
+		{"tampered body", testSecret, ts, []byte(`{"id":2}`), sig, false},
+		{"tampered signature", testSecret, ts, body, sig[:len(sig)-1] + "0", false},
+		{"wrong secret", "other", ts, body, sig, false},
+		{"timestamp not signed", testSecret, strconv.FormatInt(now+1, 10), body, sig, false},
+		{"invalid timestamp", testSecret, "abc", body, sig, false},
+		{"stale", testSecret, strconv.FormatInt(now-600, 10), body, Sign(testSecret, now-600, body), false},
+		{"future", testSecret, strconv.FormatInt(now+600, 10), body, Sign(testSecret, now+600, body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.body, tt.signature, time.Minute*5); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverNon2xx(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusGone, http.StatusInternalServerError} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			srv, _, _ := newReceiver(t, status, "nope")
+
+			res, err := NewClient(time.Second).Deliver(context.Background(), srv.URL, testSecret, EventUserFollowed, 1, []byte(`{}`))
+			if err == nil {
+				t.Fatal("Deliver returned no error")
+			}
+			if res.StatusCode != status || res.Response != "nope" {
+				t.Errorf("result = %+v, want %d nope", res, status)
+			}
+		})
+	}
+}
+
+func TestDeliverUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	res, err := NewClient(time.Second).Deliver(context.Background(), url, testSecret, EventUserFollowed, 1, []byte(`{}`))
+	if err == nil {
+		t.Fatal("Deliver returned no error")
+	}
+	if res.StatusCode != 0 {
+		t.Errorf("StatusCode = %d, want 0", res.StatusCode)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{
+		time.Second * 30,
+		time.Minute,
+		time.Minute * 2,
+		time.Minute * 4,
+		time.Minute * 8,
+		time.Minute * 16,
+		time.Minute * 32,
+		time.Hour,
+		time.Hour,
+	}
+	for i, w := range want {
+		if got := Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}